@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAccessLogWritesCommonLogFormat(t *testing.T) {
+	var out bytes.Buffer
+	h := AccessLogMiddleware(AccessLogCLF, nil, zap.NewNop(), &out)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/echo?x=1", nil)
+	req.RemoteAddr = "127.0.0.1:4321"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := regexp.MustCompile(`^127\.0\.0\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /echo\?x=1 HTTP/1\.1" 200 5\n$`)
+	if !want.MatchString(out.String()) {
+		t.Fatalf("access log line %q isn't in Common Log Format", out.String())
+	}
+}
+
+func TestAccessLogJSONLeavesWriterUnused(t *testing.T) {
+	var out bytes.Buffer
+	h := AccessLogMiddleware(AccessLogJSON, nil, zap.NewNop(), &out)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if out.Len() != 0 {
+		t.Fatalf("JSON mode wrote %q to the CLF writer", out.String())
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+
+	"go.uber.org/fx"
+	"gopkg.in/yaml.v3"
+)
+
+// FeatureFlags holds switches for optional, off-by-default behaviour
+type FeatureFlags struct {
+	// EnablePprof exposes the /debug/pprof endpoints on the admin server
+	EnablePprof bool `yaml:"enable_pprof"`
+}
+
+// loadEnv overrides the feature flags with any values set in the environment
+func (f *FeatureFlags) loadEnv() error {
+	// Keep profiling disabled unless ENABLE_PPROF opts in
+	var err error
+	f.EnablePprof, err = envBool("ENABLE_PPROF", f.EnablePprof)
+	return err
+}
+
+// AppConfig aggregates the configuration of every part of the application.
+// It is loaded from an optional YAML or JSON file, then individual fields are
+// overridden by their environment variables.
+type AppConfig struct {
+	// Server configures the HTTP servers
+	Server ServerConfig `yaml:"server"`
+	// Log configures the application logger
+	Log LogConfig `yaml:"log"`
+	// Tracing configures OpenTelemetry tracing
+	Tracing TracingConfig `yaml:"tracing"`
+	// Stats configures the per-route latency summaries
+	Stats StatsConfig `yaml:"stats"`
+	// Proxy lists the reverse proxies trusted to report client addresses
+	Proxy ProxyConfig `yaml:"proxy"`
+	// Worker configures the background worker
+	Worker WorkerConfig `yaml:"worker"`
+	// Features toggles optional behaviour
+	Features FeatureFlags `yaml:"features"`
+	// CORS is the cross-origin resource sharing policy
+	CORS CORSConfig `yaml:"cors"`
+	// SecurityHeaders sets the security headers sent on every response
+	SecurityHeaders SecurityHeadersConfig `yaml:"security_headers"`
+	// ResponseHeaders sets custom default headers on every response
+	ResponseHeaders ResponseHeadersConfig `yaml:"response_headers"`
+	// HTTPSRedirect redirects plain HTTP requests to HTTPS
+	HTTPSRedirect HTTPSRedirectConfig `yaml:"https_redirect"`
+	// Auth holds the credentials for protected routes
+	Auth AuthConfig `yaml:"auth"`
+	// RateLimit configures per-client rate limiting
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// Static configures static asset serving
+	Static StaticConfig `yaml:"static"`
+	// Echo configures the echo route
+	Echo EchoConfig `yaml:"echo"`
+	// WebSocket configures the WebSocket routes
+	WebSocket WSConfig `yaml:"websocket"`
+	// Idempotency configures replaying responses to retried requests
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	// Cache configures the in-memory response cache
+	Cache CacheConfig `yaml:"cache"`
+	// RecentRequests configures the buffer of recent requests
+	RecentRequests RecentRequestsConfig `yaml:"recent_requests"`
+	// Dump configures logging full requests for debugging
+	Dump DumpConfig `yaml:"dump"`
+	// DB configures the SQL database used with DBModule
+	DB DBConfig `yaml:"db"`
+	// Redis configures the Redis client used with RedisModule
+	Redis RedisConfig `yaml:"redis"`
+}
+
+// defaultAppConfig returns the AppConfig used when nothing is configured
+func defaultAppConfig() *AppConfig {
+	return &AppConfig{
+		Server: defaultServerConfig(),
+		Log: LogConfig{
+			// Default to production-style JSON logs on stderr
+			Level:       "info",
+			Encoding:    "json",
+			OutputPaths: []string{"stderr"},
+		},
+		Tracing: TracingConfig{
+			ServiceName: "fxdemo",
+			SampleRatio: 1,
+		},
+		Stats:  StatsConfig{Window: defaultStatsWindow},
+		Worker: WorkerConfig{Interval: defaultWorkerInterval},
+		CORS: CORSConfig{
+			// Allow no origins unless configured
+			AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		},
+		SecurityHeaders: SecurityHeadersConfig{
+			ContentTypeOptions:      "nosniff",
+			FrameOptions:            "DENY",
+			StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+			ContentSecurityPolicy:   "default-src 'self'",
+		},
+		HTTPSRedirect: HTTPSRedirectConfig{
+			// Keep probes and scrapes working over plain HTTP
+			ExemptPaths: []string{"/healthz", "/readyz", "/metrics"},
+		},
+		Auth: AuthConfig{Realm: "restricted"},
+		RateLimit: RateLimitConfig{
+			Burst:   1,
+			IdleTTL: defaultRateLimitIdleTTL,
+		},
+		Static: StaticConfig{
+			Dir:    "./static",
+			Prefix: "/static/",
+		},
+		Echo: EchoConfig{MaxBodyBytes: defaultMaxRequestBodyBytes},
+		WebSocket: WSConfig{
+			ReadTimeout:     defaultWSReadTimeout,
+			WriteTimeout:    defaultWSWriteTimeout,
+			MaxMessageBytes: defaultMaxRequestBodyBytes,
+		},
+		Idempotency: IdempotencyConfig{
+			MaxKeys:      defaultIdempotencyMaxKeys,
+			MaxBodyBytes: defaultIdempotencyMaxBodyBytes,
+		},
+		Cache: CacheConfig{
+			MaxEntries:    defaultCacheMaxEntries,
+			MaxEntryBytes: defaultCacheMaxEntryBytes,
+		},
+		RecentRequests: RecentRequestsConfig{
+			Size:         defaultRecentRequestsSize,
+			MaxBodyBytes: defaultRecentRequestsMaxBodyBytes,
+		},
+		Dump: DumpConfig{
+			MaxBodyBytes:  defaultDumpMaxBodyBytes,
+			RedactHeaders: []string{"Authorization", "Cookie", "Proxy-Authorization"},
+		},
+		DB: DBConfig{
+			MaxOpenConns:    10,
+			MaxIdleConns:    2,
+			ConnMaxLifetime: defaultDBConnMaxLifetime,
+		},
+		Redis: RedisConfig{
+			PoolSize:     10,
+			DialTimeout:  defaultRedisDialTimeout,
+			ReadTimeout:  defaultRedisIOTimeout,
+			WriteTimeout: defaultRedisIOTimeout,
+		},
+	}
+}
+
+// LoadConfig reads the YAML or JSON file at path over the defaults and then
+// applies environment overrides. An empty path skips the file, leaving the
+// defaults and the environment. The result is checked by Validate once the
+// application starts.
+func LoadConfig(path string) (*AppConfig, error) {
+	cfg := defaultAppConfig()
+
+	// Decode the file over the defaults, which also accepts JSON as a subset of YAML
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open config file: %w", err)
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	// Let the environment override individual fields
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// redactedValue replaces the sensitive settings shown by Redact
+const redactedValue = "[REDACTED]"
+
+// Redact returns a copy of the config with every string field tagged
+// `sensitive:"true"`, like passwords and DSNs, masked. Unset fields stay
+// empty so it remains visible that they aren't configured.
+func (c AppConfig) Redact() AppConfig {
+	redactSensitive(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// redactSensitive masks the sensitive string fields of the struct v,
+// descending into nested structs
+func redactSensitive(v reflect.Value) {
+	for i := range v.NumField() {
+		f, fv := v.Type().Field(i), v.Field(i)
+		switch {
+		case !f.IsExported():
+		case f.Type.Kind() == reflect.Struct:
+			redactSensitive(fv)
+		case f.Tag.Get("sensitive") == "true" && f.Type.Kind() == reflect.String && !fv.IsZero():
+			fv.SetString(redactedValue)
+		}
+	}
+}
+
+// loadEnv applies the environment overrides of every section
+func (c *AppConfig) loadEnv() error {
+	c.Auth.loadEnv()
+	c.Proxy.loadEnv()
+	c.SecurityHeaders.loadEnv()
+	c.Log.loadEnv()
+	c.Static.loadEnv()
+	for _, load := range []func() error{
+		c.Server.loadEnv,
+		c.Tracing.loadEnv,
+		c.Stats.loadEnv,
+		c.Worker.loadEnv,
+		c.Features.loadEnv,
+		c.CORS.loadEnv,
+		c.ResponseHeaders.loadEnv,
+		c.HTTPSRedirect.loadEnv,
+		c.RateLimit.loadEnv,
+		c.Echo.loadEnv,
+		c.WebSocket.loadEnv,
+		c.Idempotency.loadEnv,
+		c.Cache.loadEnv,
+		c.RecentRequests.loadEnv,
+		c.Dump.loadEnv,
+		c.DB.loadEnv,
+		c.Redis.loadEnv,
+	} {
+		if err := load(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewAppConfig merges the command-line flags, environment and config file
+// into the AppConfig, see ParseFlags, and validates it. Validating here
+// rather than in an fx.Invoke matters because the fx event logger is built
+// from the config before any invoke runs, so a bad setting would otherwise
+// surface as whichever constructor trips over it.
+func NewAppConfig() (*AppConfig, error) {
+	cfg, err := ParseFlags(os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configSections hands each section of the AppConfig to the graph on its own,
+// so components depend only on the settings they use
+type configSections struct {
+	fx.Out
+
+	Server          ServerConfig
+	Log             LogConfig
+	Tracing         TracingConfig
+	Stats           StatsConfig
+	Proxy           ProxyConfig
+	Worker          WorkerConfig
+	Features        FeatureFlags
+	CORS            CORSConfig
+	SecurityHeaders SecurityHeadersConfig
+	ResponseHeaders ResponseHeadersConfig
+	HTTPSRedirect   HTTPSRedirectConfig
+	Auth            AuthConfig
+	RateLimit       RateLimitConfig
+	Static          StaticConfig
+	Echo            EchoConfig
+	WebSocket       WSConfig
+	Idempotency     IdempotencyConfig
+	Cache           CacheConfig
+	RecentRequests  RecentRequestsConfig
+	Dump            DumpConfig
+	DB              DBConfig
+	Redis           RedisConfig
+}
+
+// NewConfigSections splits the AppConfig into its sections
+func NewConfigSections(cfg *AppConfig) configSections {
+	return configSections{
+		Server:          cfg.Server,
+		Log:             cfg.Log,
+		Tracing:         cfg.Tracing,
+		Stats:           cfg.Stats,
+		Proxy:           cfg.Proxy,
+		Worker:          cfg.Worker,
+		Features:        cfg.Features,
+		CORS:            cfg.CORS,
+		SecurityHeaders: cfg.SecurityHeaders,
+		ResponseHeaders: cfg.ResponseHeaders,
+		HTTPSRedirect:   cfg.HTTPSRedirect,
+		Auth:            cfg.Auth,
+		RateLimit:       cfg.RateLimit,
+		Static:          cfg.Static,
+		Echo:            cfg.Echo,
+		WebSocket:       cfg.WebSocket,
+		Idempotency:     cfg.Idempotency,
+		Cache:           cfg.Cache,
+		RecentRequests:  cfg.RecentRequests,
+		Dump:            cfg.Dump,
+		DB:              cfg.DB,
+		Redis:           cfg.Redis,
+	}
+}
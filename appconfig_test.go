@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestRedactMasksACopy(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Auth.Password = "hunter2"
+	cfg.Server.TLSKeyFile = "/etc/tls/key.pem"
+	cfg.Redis.Addr = "127.0.0.1:6379"
+
+	redacted := cfg.Redact()
+	if redacted.Auth.Password != redactedValue || redacted.Server.TLSKeyFile != redactedValue {
+		t.Errorf("redacted password %q and key file %q, want both masked", redacted.Auth.Password, redacted.Server.TLSKeyFile)
+	}
+	if redacted.Redis.Addr != "127.0.0.1:6379" || redacted.DB.DSN != "" {
+		t.Errorf("redacted addr %q and DSN %q, want the addr shown and the unset DSN empty", redacted.Redis.Addr, redacted.DB.DSN)
+	}
+
+	// The receiver keeps its real values
+	if cfg.Auth.Password != "hunter2" || cfg.Server.TLSKeyFile != "/etc/tls/key.pem" {
+		t.Errorf("Redact changed its receiver, password %q and key file %q", cfg.Auth.Password, cfg.Server.TLSKeyFile)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// contextReader is an io.Reader that stops returning data once its context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// newContextReader wraps r so reads fail with the context's error after cancellation
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+// Read checks the context before each read from the underlying reader
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// flushWriter is an io.Writer that flushes the response after every write,
+// so streamed data reaches the client chunk by chunk
+type flushWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// newFlushWriter wraps w so each write is flushed to the client
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	return &flushWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+// Write writes p and flushes it, falling back to plain writes for good once
+// the writer turns out not to support flushing
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err != nil || fw.rc == nil {
+		return n, err
+	}
+	if err := fw.rc.Flush(); err != nil {
+		if !errors.Is(err, http.ErrNotSupported) {
+			return n, err
+		}
+		fw.rc = nil
+	}
+	return n, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCacheMaxEntries caps how many responses are cached by default
+	defaultCacheMaxEntries = 1000
+	// defaultCacheMaxEntryBytes caps the body of each cached response by default
+	defaultCacheMaxEntryBytes = 1 << 20
+)
+
+// CacheConfig holds the configuration for the in-memory response cache
+type CacheConfig struct {
+	// TTL is how long a response is served from the cache, zero disables caching
+	TTL time.Duration `yaml:"ttl"`
+	// MaxEntries caps the cached responses, evicting the least recently used
+	MaxEntries int `yaml:"max_entries"`
+	// MaxEntryBytes is the largest body cached, bigger responses are never cached
+	MaxEntryBytes int64 `yaml:"max_entry_bytes"`
+}
+
+// loadEnv overrides the cache config with any values set in the environment
+func (c *CacheConfig) loadEnv() error {
+	var err error
+	if c.TTL, err = envDuration("CACHE_TTL", c.TTL); err != nil {
+		return err
+	}
+	if c.MaxEntries, err = envInt("CACHE_MAX_ENTRIES", c.MaxEntries); err != nil {
+		return err
+	}
+	if c.MaxEntryBytes, err = envInt64("CACHE_MAX_ENTRY_BYTES", c.MaxEntryBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a negative TTL or size cap
+func (c *CacheConfig) Validate() error {
+	return errors.Join(
+		checkNotNegative("cache.ttl", c.TTL),
+		checkNotNegative("cache.max_entries", c.MaxEntries),
+		checkNotNegative("cache.max_entry_bytes", c.MaxEntryBytes),
+	)
+}
+
+// cachedResponse is a response stored in the ResponseCache
+type cachedResponse struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+// writeTo replays the stored response on w
+func (resp *cachedResponse) writeTo(w http.ResponseWriter) {
+	h := w.Header()
+	for name, values := range resp.header {
+		h[name] = slices.Clone(values)
+	}
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+}
+
+// changedHeaders returns the headers in after that were added or changed
+// since before, a clone taken before the inner handler ran
+func changedHeaders(before, after http.Header) http.Header {
+	header := make(http.Header)
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			header[name] = slices.Clone(values)
+		}
+	}
+	return header
+}
+
+// ResponseCache is an in-memory LRU cache of GET responses keyed by URL.
+// Routes opt in by adding its middleware through RouteWithMiddleware:
+//
+//	func (h *MyHandler) Middlewares() []Middleware {
+//		return []Middleware{h.cache.Middleware()}
+//	}
+type ResponseCache struct {
+	cfg     CacheConfig
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// NewResponseCache creates an empty ResponseCache
+func NewResponseCache(cfg CacheConfig) *ResponseCache {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultCacheMaxEntries
+	}
+	if cfg.MaxEntryBytes <= 0 {
+		cfg.MaxEntryBytes = defaultCacheMaxEntryBytes
+	}
+	return &ResponseCache{cfg: cfg, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the unexpired response stored under key, marking it as
+// recently used
+func (c *ResponseCache) get(key string, now time.Time) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	resp := el.Value.(*cachedResponse)
+	if !now.Before(resp.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return resp, true
+}
+
+// put stores resp, evicting the least recently used responses beyond the cap
+func (c *ResponseCache) put(resp *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[resp.key]; ok {
+		el.Value = resp
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[resp.key] = c.lru.PushFront(resp)
+	for c.lru.Len() > c.cfg.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// cacheable reports whether r may be answered from, and stored in, the
+// cache. Only anonymous GETs are, and "Cache-Control: no-store" opts out.
+func cacheable(r *http.Request) bool {
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		return false
+	}
+	if _, ok := UserFromContext(r.Context()); ok {
+		return false
+	}
+	return !strings.Contains(r.Header.Get("Cache-Control"), "no-store")
+}
+
+// Middleware serves GET responses from the cache until their TTL runs out.
+// "Cache-Control: no-cache" skips the cached copy and refreshes it. Only 200
+// responses without cookies or a private or no-store Cache-Control are
+// stored, and only the headers the route set, not those of the middleware
+// wrapping it.
+func (c *ResponseCache) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		if c.cfg.TTL <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cacheable(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Answer from the cache unless the client asks for a fresh response
+			key := r.Host + r.URL.RequestURI()
+			now := time.Now()
+			if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				if resp, ok := c.get(key, now); ok {
+					w.Header().Set("Age", strconv.Itoa(int(now.Sub(resp.stored).Seconds())))
+					w.Header().Set("X-Cache", "HIT")
+					resp.writeTo(w)
+					return
+				}
+			}
+
+			// Serve the route, recording the response to store
+			before := w.Header().Clone()
+			w.Header().Set("X-Cache", "MISS")
+			rec := &cacheRecorder{ResponseWriter: w, body: &capBuffer{max: c.cfg.MaxEntryBytes}}
+			next.ServeHTTP(rec, r)
+			if rec.Status() != http.StatusOK || rec.tooLarge() || !storable(w.Header()) {
+				return
+			}
+
+			// Keep only the headers the route itself added or changed
+			header := changedHeaders(before, w.Header())
+			header.Del("X-Cache")
+			c.put(&cachedResponse{
+				key:     key,
+				status:  http.StatusOK,
+				header:  header,
+				body:    bytes.Clone(rec.body.Bytes()),
+				stored:  now,
+				expires: now.Add(c.cfg.TTL),
+			})
+		})
+	}
+}
+
+// storable reports whether a response's headers allow sharing it
+func storable(h http.Header) bool {
+	cc := h.Get("Cache-Control")
+	return h.Get("Set-Cookie") == "" && !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// cacheRecorder records the status and the start of the body of a response
+// as it is written
+type cacheRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+	body    *capBuffer
+}
+
+// WriteHeader records the status code before sending it
+func (cr *cacheRecorder) WriteHeader(status int) {
+	if cr.status == 0 {
+		cr.status = status
+	}
+	cr.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body before passing it on
+func (cr *cacheRecorder) Write(b []byte) (int, error) {
+	if cr.status == 0 {
+		cr.status = http.StatusOK
+	}
+	cr.written += int64(len(b))
+	cr.body.Write(b)
+	return cr.ResponseWriter.Write(b)
+}
+
+// Status returns the recorded status code, or 200 if nothing was written
+func (cr *cacheRecorder) Status() int {
+	if cr.status == 0 {
+		return http.StatusOK
+	}
+	return cr.status
+}
+
+// tooLarge reports whether the body outgrew what the cache keeps
+func (cr *cacheRecorder) tooLarge() bool {
+	return cr.written > int64(cr.body.Len())
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cr *cacheRecorder) Unwrap() http.ResponseWriter {
+	return cr.ResponseWriter
+}
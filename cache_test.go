@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// callCountHandler answers with how many times it has been called
+func callCountHandler(calls *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "call %d", *calls)
+	})
+}
+
+// cachedGet serves a GET of path through h, with an optional Cache-Control
+func cachedGet(h http.Handler, path, cacheControl string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if cacheControl != "" {
+		r.Header.Set("Cache-Control", cacheControl)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestCacheServesRepeatsWithinTTL(t *testing.T) {
+	var calls int
+	h := NewResponseCache(CacheConfig{TTL: time.Minute}).Middleware()(callCountHandler(&calls))
+
+	if rec := cachedGet(h, "/items", ""); rec.Body.String() != "call 1" || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first GET = %q %s, want call 1 MISS", rec.Body, rec.Header().Get("X-Cache"))
+	}
+
+	// The second request is replayed from the cache, headers included
+	rec := cachedGet(h, "/items", "")
+	if rec.Body.String() != "call 1" || rec.Header().Get("X-Cache") != "HIT" || calls != 1 {
+		t.Fatalf("second GET = %q %s after %d calls, want the cached call 1", rec.Body, rec.Header().Get("X-Cache"), calls)
+	}
+	if rec.Header().Get("Content-Type") != "text/plain" || rec.Header().Get("Age") != "0" {
+		t.Errorf("cached headers %v, want the route's Content-Type and an Age", rec.Header())
+	}
+
+	// A different query is a different entry
+	if rec := cachedGet(h, "/items?page=2", ""); rec.Body.String() != "call 2" {
+		t.Errorf("GET with a query = %q, want a fresh call 2", rec.Body)
+	}
+}
+
+func TestCacheNoCacheBypassesAndRefreshes(t *testing.T) {
+	var calls int
+	h := NewResponseCache(CacheConfig{TTL: time.Minute}).Middleware()(callCountHandler(&calls))
+	cachedGet(h, "/items", "")
+
+	// no-cache goes to the route and stores what it returns
+	if rec := cachedGet(h, "/items", "no-cache"); rec.Body.String() != "call 2" || rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("no-cache GET = %q %s, want a fresh call 2", rec.Body, rec.Header().Get("X-Cache"))
+	}
+	if rec := cachedGet(h, "/items", ""); rec.Body.String() != "call 2" {
+		t.Fatalf("GET after no-cache = %q, want the refreshed call 2", rec.Body)
+	}
+
+	// no-store neither reads nor writes the cache
+	if rec := cachedGet(h, "/items", "no-store"); rec.Body.String() != "call 3" {
+		t.Fatalf("no-store GET = %q, want a fresh call 3", rec.Body)
+	}
+	if rec := cachedGet(h, "/items", ""); rec.Body.String() != "call 2" {
+		t.Fatalf("GET after no-store = %q, want the cached call 2 untouched", rec.Body)
+	}
+}
+
+func TestCacheExpiresAndEvicts(t *testing.T) {
+	var calls int
+	h := NewResponseCache(CacheConfig{TTL: 50 * time.Millisecond, MaxEntries: 2}).Middleware()(callCountHandler(&calls))
+
+	// Touching /a makes /b the least recently used when /c comes in
+	cachedGet(h, "/a", "")
+	cachedGet(h, "/b", "")
+	cachedGet(h, "/a", "")
+	cachedGet(h, "/c", "")
+	for path, want := range map[string]string{"/a": "HIT", "/c": "HIT"} {
+		if rec := cachedGet(h, path, ""); rec.Header().Get("X-Cache") != want {
+			t.Errorf("GET %s = %s, want %s", path, rec.Header().Get("X-Cache"), want)
+		}
+	}
+	if rec := cachedGet(h, "/b", ""); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("GET /b = %s, want MISS after its eviction", rec.Header().Get("X-Cache"))
+	}
+
+	// Past the TTL the route is served again
+	time.Sleep(60 * time.Millisecond)
+	if rec := cachedGet(h, "/a", ""); rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("GET /a after the TTL = %s, want MISS", rec.Header().Get("X-Cache"))
+	}
+}
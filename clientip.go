@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ProxyConfig holds the reverse proxies whose forwarding headers are trusted
+type ProxyConfig struct {
+	// TrustedProxies lists the CIDR ranges or single IPs of trusted proxies
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// loadEnv overrides the trusted proxies with any set in TRUSTED_PROXIES
+func (c *ProxyConfig) loadEnv() {
+	c.TrustedProxies = envList("TRUSTED_PROXIES", c.TrustedProxies)
+}
+
+// Validate reports trusted proxies that are neither an IP nor a CIDR range
+func (c *ProxyConfig) Validate() error {
+	if _, err := NewTrustedProxies(*c); err != nil {
+		return fmt.Errorf("proxy.trusted_proxies: %w", err)
+	}
+	return nil
+}
+
+// TrustedProxies are the networks allowed to report the client address in
+// X-Forwarded-For
+type TrustedProxies []net.IPNet
+
+// NewTrustedProxies parses the configured proxy ranges, treating a bare IP
+// as a single-address range
+func NewTrustedProxies(cfg ProxyConfig) (TrustedProxies, error) {
+	proxies := make(TrustedProxies, 0, len(cfg.TrustedProxies))
+	for _, s := range cfg.TrustedProxies {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", s)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			proxies = append(proxies, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", s, err)
+		}
+		proxies = append(proxies, *ipNet)
+	}
+	return proxies, nil
+}
+
+// trusts reports whether ip belongs to one of the trusted networks
+func trusts(trustedProxies []net.IPNet, ip net.IP) bool {
+	return slices.ContainsFunc(trustedProxies, func(n net.IPNet) bool {
+		return n.Contains(ip)
+	})
+}
+
+// ClientIP returns the requesting client's IP. X-Forwarded-For is only
+// believed when the peer is a trusted proxy, and is then walked from the
+// right, skipping further trusted proxies, so a client can't spoof its
+// address by sending the header itself. It returns nil when the peer
+// address isn't an IP, e.g. on a Unix socket.
+func ClientIP(r *http.Request, trustedProxies []net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trusts(trustedProxies, ip) {
+		return ip
+	}
+
+	// Each proxy appends the address it received the request from
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// Don't look past a malformed entry, it may have been injected
+			break
+		}
+		ip = hop
+		if !trusts(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// clientAddr returns ClientIP as a string, falling back to the raw peer
+// address when it isn't an IP
+func clientAddr(r *http.Request, trustedProxies []net.IPNet) string {
+	if ip := ClientIP(r, trustedProxies); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPIgnoresSpoofedHeaders(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := []net.IPNet{*proxies}
+
+	for name, tc := range map[string]struct {
+		remote, forwarded, want string
+	}{
+		"no header":               {"203.0.113.7:1234", "", "203.0.113.7"},
+		"spoofed by the client":   {"203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		"set by a trusted proxy":  {"10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		"spoof behind a proxy":    {"10.0.0.2:1234", "192.0.2.66, 198.51.100.1", "198.51.100.1"},
+		"chain of proxies":        {"10.0.0.2:1234", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		"malformed hop":           {"10.0.0.2:1234", "198.51.100.1, bogus", "10.0.0.2"},
+		"only trusted proxies":    {"10.0.0.2:1234", "10.0.0.3", "10.0.0.3"},
+		"untrusted private range": {"192.168.1.5:1234", "198.51.100.1", "192.168.1.5"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tc.remote
+			if tc.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+			if got := ClientIP(r, trusted).String(); got != tc.want {
+				t.Fatalf("ClientIP = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
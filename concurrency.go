@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConcurrencyLimitedRoute is a route that caps how many of its requests run
+// at once, for endpoints too expensive to run unbounded in parallel
+type ConcurrencyLimitedRoute interface {
+	Route
+	// MaxConcurrency is the number of requests served at once, zero or
+	// negative leaves them unlimited
+	MaxConcurrency() int
+}
+
+// routeConcurrency returns the concurrency limit of a route, preferring the
+// limit configured for its pattern over the route's own
+func routeConcurrency(route Route, cfg ServerConfig) int {
+	if limit, ok := cfg.ConcurrencyLimits[routePattern(route, cfg)]; ok {
+		return limit
+	}
+	if cr, ok := route.(ConcurrencyLimitedRoute); ok {
+		return cr.MaxConcurrency()
+	}
+	return 0
+}
+
+// ConcurrencyLimitMiddleware serves at most limit requests at once, using a
+// buffered channel as a semaphore. Requests beyond the limit wait up to wait
+// for a slot and are then answered with a 503.
+func ConcurrencyLimitMiddleware(limit int, wait time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+		sem := make(chan struct{}, limit)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acquire(r, sem, wait) {
+				w.Header().Set("Retry-After", "1")
+				RespondError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Too many concurrent requests")
+				return
+			}
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquire takes a slot of sem, waiting up to wait or until the request is
+// cancelled, and reports whether it got one
+func acquire(r *http.Request, sem chan struct{}, wait time.Duration) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// parseConcurrencyLimits parses "pattern=limit" entries
+func parseConcurrencyLimits(entries []string) (map[string]int, error) {
+	limits := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid concurrency limit %q, expected pattern=limit", entry)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid concurrency limit %q: %w", entry, err)
+		}
+		limits[pattern] = limit
+	}
+	return limits, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// limitedRoute gives a func route its own concurrency limit
+type limitedRoute struct {
+	Route
+	limit int
+}
+
+func (r limitedRoute) MaxConcurrency() int { return r.limit }
+
+// fireConcurrently sends n requests to path at once while the handler
+// blocks, and returns the statuses of those answered before it is released
+func fireConcurrently(t *testing.T, h http.Handler, path string, n int, entered <-chan struct{}, release chan struct{}, running int) []int {
+	t.Helper()
+	var wg sync.WaitGroup
+	codes := make(chan int, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			codes <- rec.Code
+		}()
+	}
+
+	// Wait for the limit to fill, then for the excess to be turned away
+	for range running {
+		select {
+		case <-entered:
+		case <-time.After(2 * time.Second):
+			t.Fatal("handler not entered")
+		}
+	}
+	rejected := make([]int, 0, n-running)
+	for range n - running {
+		select {
+		case code := <-codes:
+			rejected = append(rejected, code)
+		case <-time.After(2 * time.Second):
+			t.Fatal("request beyond the limit still waiting")
+		}
+	}
+	close(release)
+	wg.Wait()
+	return rejected
+}
+
+func TestConcurrencyLimitRejectsExcessRequests(t *testing.T) {
+	entered := make(chan struct{}, 5)
+	release := make(chan struct{})
+	busy := func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}
+	h := newTestMux(t, defaultServerConfig(), limitedRoute{NewFuncRoute("/expensive", busy), 2})
+
+	// Two requests run while the other three are answered 503 straight away
+	for _, code := range fireConcurrently(t, h, "/expensive", 5, entered, release, 2) {
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("request beyond the limit got %d, want 503", code)
+		}
+	}
+}
+
+func TestConcurrencyLimitsConfigOverridesRoute(t *testing.T) {
+	entered := make(chan struct{}, 4)
+	release := make(chan struct{})
+	busy := func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}
+	cfg := defaultServerConfig()
+	cfg.ConcurrencyLimits = map[string]int{"/expensive": 1}
+	h := newTestMux(t, cfg, limitedRoute{NewFuncRoute("/expensive", busy), 3})
+
+	// The configured limit of one wins over the route's own three
+	for _, code := range fireConcurrently(t, h, "/expensive", 4, entered, release, 1) {
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("request beyond the limit got %d, want 503", code)
+		}
+	}
+}
+
+func TestConcurrencyLimitWaitsForASlot(t *testing.T) {
+	// A request over the limit takes the slot freed within the wait
+	h := ConcurrencyLimitMiddleware(1, 2*time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes[i] = rec.Code
+		}()
+	}
+	wg.Wait()
+	for _, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("got %d, want both requests served", code)
+		}
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultAddr is the listen address used when none is configured
+	defaultAddr = ":8080"
+	// defaultAdminAddr is the listen address of the admin server
+	defaultAdminAddr = ":9090"
+	// defaultStartupTimeout bounds how long the OnStart hooks may take together
+	defaultStartupTimeout = 15 * time.Second
+	// defaultShutdownTimeout bounds how long the OnStop hooks may take together
+	defaultShutdownTimeout = 30 * time.Second
+	// defaultDrainTimeout bounds how long open connections may take to drain
+	defaultDrainTimeout = 10 * time.Second
+	// defaultForceCloseTimeout bounds how long requests may run on once
+	// their connections have been force-closed
+	defaultForceCloseTimeout = 5 * time.Second
+	// defaultHealthCheckTimeout bounds how long each health check may take
+	defaultHealthCheckTimeout = 2 * time.Second
+	// defaultRequestTimeout bounds how long a single route may take to respond
+	defaultRequestTimeout = 10 * time.Second
+	// defaultReadTimeout bounds how long reading a whole request may take
+	defaultReadTimeout = 15 * time.Second
+	// defaultReadHeaderTimeout bounds how long reading request headers may take
+	defaultReadHeaderTimeout = 5 * time.Second
+	// defaultWriteTimeout bounds how long writing a response may take
+	defaultWriteTimeout = 15 * time.Second
+	// defaultIdleTimeout bounds how long a keep-alive connection may sit idle
+	defaultIdleTimeout = 60 * time.Second
+	// defaultMaxRequestBodyBytes caps buffered request bodies at 1 MiB
+	defaultMaxRequestBodyBytes = 1 << 20
+	// defaultGzipMinBytes is the smallest response worth compressing
+	defaultGzipMinBytes = 1024
+	// defaultMaxDecompressedBodyBytes caps gzip request bodies at 10 MiB once inflated
+	defaultMaxDecompressedBodyBytes = 10 << 20
+	// defaultMaxHeaderBytes matches the net/http default of 1 MiB
+	defaultMaxHeaderBytes = 1 << 20
+	// defaultMaxURIBytes caps the request target at 8 KiB, in line with common proxies
+	defaultMaxURIBytes = 8 << 10
+	// defaultMaxHeaderCount caps the number of request header fields
+	defaultMaxHeaderCount = 100
+	// defaultListenRetryBackoff is the wait before the first bind retry
+	defaultListenRetryBackoff = 100 * time.Millisecond
+	// defaultListenRetryMaxBackoff caps the wait between bind retries
+	defaultListenRetryMaxBackoff = 5 * time.Second
+)
+
+// ListenRetryConfig controls retrying a failed bind, e.g. while the port of
+// a quickly restarted process is still in TIME_WAIT
+type ListenRetryConfig struct {
+	// MaxAttempts is how many times to try binding, one disables retries
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialBackoff is the wait before the first retry, doubling after each
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// ServerConfig holds the configuration for the HTTP server
+type ServerConfig struct {
+	// Network is the listener network, "tcp" or "unix"
+	Network string `yaml:"network"`
+	// Addr is the TCP address the server listens on
+	Addr string `yaml:"addr"`
+	// ExtraAddrs are further TCP addresses served alongside Addr, so a new
+	// port can be brought up and the old one drained during a rotation
+	ExtraAddrs []string `yaml:"extra_addrs"`
+	// AdminAddr is the TCP address the admin server listens on
+	AdminAddr string `yaml:"admin_addr"`
+	// Router selects the router implementation, "servemux" or "chi"
+	Router string `yaml:"router"`
+	// SocketPath is the Unix domain socket path used when Network is "unix"
+	SocketPath string `yaml:"socket_path"`
+	// MaxConnections caps the number of simultaneously accepted connections,
+	// zero or negative leaves them unlimited
+	MaxConnections int `yaml:"max_connections"`
+	// ServeWhileDraining keeps answering requests once shutdown has begun
+	// instead of turning them away, set only for the admin server
+	ServeWhileDraining bool `yaml:"-"`
+	// EnableH2C serves HTTP/2 over cleartext connections alongside HTTP/1.1,
+	// for deployments behind a TLS-terminating proxy
+	EnableH2C bool `yaml:"enable_h2c"`
+	// DisableKeepAlives closes every connection after a single request
+	DisableKeepAlives bool `yaml:"disable_keep_alives"`
+	// ListenRetry controls retrying the bind while the address is in use, off
+	// by default
+	ListenRetry ListenRetryConfig `yaml:"listen_retry"`
+	// StartupTimeout is how long the application may take to start before
+	// it gives up, so a hung OnStart hook can't block it forever
+	StartupTimeout time.Duration `yaml:"startup_timeout"`
+	// ShutdownTimeout is how long the application may take to stop, and
+	// must cover the lame duck period, drain and force-close timeouts
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// DrainTimeout is how long to wait on stop for open connections to
+	// finish their requests before they are force-closed
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+	// ForceCloseTimeout is how long to wait after force-closing connections
+	// for their handlers to return
+	ForceCloseTimeout time.Duration `yaml:"force_close_timeout"`
+	// ReusePort sets SO_REUSEPORT on the listener so another process can
+	// bind the same port, e.g. during a zero-downtime binary upgrade
+	ReusePort bool `yaml:"reuse_port"`
+	// ListenBacklog is the length of the accept queue of TCP listeners, zero
+	// keeps Go's default of the system maximum. The kernel caps it at that
+	// maximum, and only Unix platforms support setting it.
+	ListenBacklog int `yaml:"listen_backlog"`
+	// TCPKeepAlive is the keep-alive probe period of accepted connections,
+	// zero keeps Go's default of 15s and a negative value disables probes
+	TCPKeepAlive time.Duration `yaml:"tcp_keep_alive"`
+	// LameDuckPeriod is how long to keep serving after readiness flips to
+	// false on stop, before shutdown begins
+	LameDuckPeriod time.Duration `yaml:"lame_duck_period"`
+	// MaxResponseBytes truncates responses of routes that aren't streaming
+	// at this many bytes, zero leaves them unlimited
+	MaxResponseBytes int64 `yaml:"max_response_bytes"`
+	// ConcurrencyLimits caps the requests served at once per route pattern,
+	// overriding the limits routes set for themselves
+	ConcurrencyLimits map[string]int `yaml:"concurrency_limits"`
+	// ConcurrencyWait is how long a request over a concurrency limit waits
+	// for a slot before a 503, zero rejects it straight away
+	ConcurrencyWait time.Duration `yaml:"concurrency_wait"`
+	// HealthCheckTimeout is how long each health check may take before it
+	// counts as failed
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+	// RequestTimeout is how long a route may run before a 503 is returned,
+	// zero or negative disables the timeout
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+	// ReadTimeout is the maximum duration for reading an entire request
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// ReadHeaderTimeout is the maximum duration for reading request headers
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	// WriteTimeout is the maximum duration before timing out response writes
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdleTimeout is the maximum time to wait for the next keep-alive request
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// MaxRequestBodyBytes caps the size of request bodies read into memory
+	MaxRequestBodyBytes int64 `yaml:"max_request_body_bytes"`
+	// MaxURIBytes caps the length of the request target, answering longer
+	// ones with a 414, zero or negative leaves it unlimited
+	MaxURIBytes int `yaml:"max_uri_bytes"`
+	// MaxHeaderBytes caps the size of the request line and headers
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+	// MaxHeaderCount caps the number of request header fields, answering
+	// more with a 431, zero or negative leaves them unlimited
+	MaxHeaderCount int `yaml:"max_header_count"`
+	// GzipMinBytes is the minimum response size that gets gzip-compressed
+	GzipMinBytes int `yaml:"gzip_min_bytes"`
+	// MaxDecompressedBodyBytes caps the inflated size of gzip request bodies
+	MaxDecompressedBodyBytes int64 `yaml:"max_decompressed_body_bytes"`
+	// BasePath is prepended to the path of every route, like "/api" to serve
+	// "/hello" at "/api/hello". The admin server never uses one.
+	BasePath string `yaml:"base_path"`
+	// BasePathExempt lists the route paths served without the BasePath, such
+	// as probes. Paths ending in a slash exempt the whole subtree.
+	BasePathExempt []string `yaml:"base_path_exempt"`
+	// TrailingSlash is "strip" or "redirect" to treat "/hello/" as "/hello",
+	// empty routes paths as requested
+	TrailingSlash TrailingSlashPolicy `yaml:"trailing_slash"`
+	// AccessLogFormat selects JSON or Common Log Format request logs
+	AccessLogFormat AccessLogFormat `yaml:"access_log_format"`
+	// TLSCertFile is the path to the TLS certificate, enabling HTTPS when set
+	TLSCertFile string `yaml:"tls_cert_file" sensitive:"true"`
+	// TLSKeyFile is the path to the TLS private key, enabling HTTPS when set
+	TLSKeyFile string `yaml:"tls_key_file" sensitive:"true"`
+}
+
+// withDefaults returns a copy of the config with unset fields defaulted
+func (c ServerConfig) withDefaults() ServerConfig {
+	if c.Network == "" {
+		c.Network = "tcp"
+	}
+	if c.Addr == "" {
+		c.Addr = defaultAddr
+	}
+	if c.MaxRequestBodyBytes <= 0 {
+		c.MaxRequestBodyBytes = defaultMaxRequestBodyBytes
+	}
+	if c.GzipMinBytes <= 0 {
+		c.GzipMinBytes = defaultGzipMinBytes
+	}
+	if c.MaxHeaderBytes <= 0 {
+		c.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+	if c.MaxDecompressedBodyBytes <= 0 {
+		c.MaxDecompressedBodyBytes = defaultMaxDecompressedBodyBytes
+	}
+	if c.AccessLogFormat == "" {
+		c.AccessLogFormat = AccessLogJSON
+	}
+	if c.ListenRetry.MaxAttempts <= 0 {
+		c.ListenRetry.MaxAttempts = 1
+	}
+	for _, d := range []struct {
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{&c.StartupTimeout, defaultStartupTimeout},
+		{&c.ShutdownTimeout, defaultShutdownTimeout},
+		{&c.DrainTimeout, defaultDrainTimeout},
+		{&c.ForceCloseTimeout, defaultForceCloseTimeout},
+		{&c.HealthCheckTimeout, defaultHealthCheckTimeout},
+		{&c.ReadTimeout, defaultReadTimeout},
+		{&c.ReadHeaderTimeout, defaultReadHeaderTimeout},
+		{&c.WriteTimeout, defaultWriteTimeout},
+		{&c.IdleTimeout, defaultIdleTimeout},
+		{&c.ListenRetry.InitialBackoff, defaultListenRetryBackoff},
+		{&c.ListenRetry.MaxBackoff, defaultListenRetryMaxBackoff},
+	} {
+		if *d.value <= 0 {
+			*d.value = d.fallback
+		}
+	}
+	return c
+}
+
+// TLSEnabled reports whether both a certificate and key are configured
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// defaultServerConfig returns the ServerConfig used when nothing is configured
+func defaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Network:                  "tcp",
+		Addr:                     defaultAddr,
+		Router:                   "servemux",
+		AdminAddr:                defaultAdminAddr,
+		StartupTimeout:           defaultStartupTimeout,
+		ShutdownTimeout:          defaultShutdownTimeout,
+		DrainTimeout:             defaultDrainTimeout,
+		ForceCloseTimeout:        defaultForceCloseTimeout,
+		HealthCheckTimeout:       defaultHealthCheckTimeout,
+		RequestTimeout:           defaultRequestTimeout,
+		ReadTimeout:              defaultReadTimeout,
+		ReadHeaderTimeout:        defaultReadHeaderTimeout,
+		WriteTimeout:             defaultWriteTimeout,
+		IdleTimeout:              defaultIdleTimeout,
+		MaxRequestBodyBytes:      defaultMaxRequestBodyBytes,
+		GzipMinBytes:             defaultGzipMinBytes,
+		MaxHeaderBytes:           defaultMaxHeaderBytes,
+		MaxHeaderCount:           defaultMaxHeaderCount,
+		MaxURIBytes:              defaultMaxURIBytes,
+		MaxDecompressedBodyBytes: defaultMaxDecompressedBodyBytes,
+		AccessLogFormat:          AccessLogJSON,
+		BasePathExempt:           []string{"/healthz", "/readyz"},
+		ListenRetry: ListenRetryConfig{
+			MaxAttempts:    1,
+			InitialBackoff: defaultListenRetryBackoff,
+			MaxBackoff:     defaultListenRetryMaxBackoff,
+		},
+	}
+}
+
+// loadEnv overrides the config with any values set in the environment
+func (c *ServerConfig) loadEnv() error {
+	// Read the listen addresses and TLS files when set
+	c.Network = envString("HTTP_NETWORK", c.Network)
+	c.Addr = envString("HTTP_ADDR", c.Addr)
+	c.ExtraAddrs = envList("HTTP_EXTRA_ADDRS", c.ExtraAddrs)
+	c.AdminAddr = envString("ADMIN_HTTP_ADDR", c.AdminAddr)
+	c.SocketPath = envString("HTTP_SOCKET_PATH", c.SocketPath)
+	c.Router = envString("HTTP_ROUTER", c.Router)
+	c.BasePath = envString("HTTP_BASE_PATH", c.BasePath)
+	c.BasePathExempt = envList("HTTP_BASE_PATH_EXEMPT", c.BasePathExempt)
+	c.TrailingSlash = TrailingSlashPolicy(envString("HTTP_TRAILING_SLASH", string(c.TrailingSlash)))
+	c.TLSCertFile = envString("TLS_CERT_FILE", c.TLSCertFile)
+	c.TLSKeyFile = envString("TLS_KEY_FILE", c.TLSKeyFile)
+
+	// Read per-pattern concurrency limits from HTTP_CONCURRENCY_LIMITS, a list
+	// of pattern=limit entries
+	if entries := envList("HTTP_CONCURRENCY_LIMITS", nil); entries != nil {
+		limits, err := parseConcurrencyLimits(entries)
+		if err != nil {
+			return err
+		}
+		c.ConcurrencyLimits = limits
+	}
+
+	// Read each timeout from its environment variable when set
+	for _, d := range []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"STARTUP_TIMEOUT", &c.StartupTimeout},
+		{"SHUTDOWN_TIMEOUT", &c.ShutdownTimeout},
+		{"DRAIN_TIMEOUT", &c.DrainTimeout},
+		{"FORCE_CLOSE_TIMEOUT", &c.ForceCloseTimeout},
+		{"LAME_DUCK_PERIOD", &c.LameDuckPeriod},
+		{"HEALTH_CHECK_TIMEOUT", &c.HealthCheckTimeout},
+		{"HTTP_CONCURRENCY_WAIT", &c.ConcurrencyWait},
+		{"REQUEST_TIMEOUT", &c.RequestTimeout},
+		{"HTTP_READ_TIMEOUT", &c.ReadTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", &c.ReadHeaderTimeout},
+		{"HTTP_WRITE_TIMEOUT", &c.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", &c.IdleTimeout},
+		{"HTTP_LISTEN_RETRY_BACKOFF", &c.ListenRetry.InitialBackoff},
+		{"HTTP_LISTEN_RETRY_MAX_BACKOFF", &c.ListenRetry.MaxBackoff},
+	} {
+		var err error
+		if *d.value, err = envDuration(d.key, *d.value); err != nil {
+			return err
+		}
+	}
+
+	// Read the request body limit from MAX_REQUEST_BODY_BYTES when set
+	var err error
+	if c.MaxRequestBodyBytes, err = envInt64("MAX_REQUEST_BODY_BYTES", c.MaxRequestBodyBytes); err != nil {
+		return err
+	}
+
+	// Read the response size limit from HTTP_MAX_RESPONSE_BYTES when set
+	if c.MaxResponseBytes, err = envInt64("HTTP_MAX_RESPONSE_BYTES", c.MaxResponseBytes); err != nil {
+		return err
+	}
+
+	// Read how many times to try binding from HTTP_LISTEN_ATTEMPTS when set
+	if c.ListenRetry.MaxAttempts, err = envInt("HTTP_LISTEN_ATTEMPTS", c.ListenRetry.MaxAttempts); err != nil {
+		return err
+	}
+
+	// Read the connection cap from HTTP_MAX_CONNECTIONS when set
+	if c.MaxConnections, err = envInt("HTTP_MAX_CONNECTIONS", c.MaxConnections); err != nil {
+		return err
+	}
+
+	// Read whether to speak cleartext HTTP/2 from HTTP_ENABLE_H2C
+	if c.EnableH2C, err = envBool("HTTP_ENABLE_H2C", c.EnableH2C); err != nil {
+		return err
+	}
+
+	// Read whether to turn keep-alives off from HTTP_DISABLE_KEEP_ALIVES
+	if c.DisableKeepAlives, err = envBool("HTTP_DISABLE_KEEP_ALIVES", c.DisableKeepAlives); err != nil {
+		return err
+	}
+
+	// Read the header limits from HTTP_MAX_HEADER_BYTES and HTTP_MAX_HEADER_COUNT when set
+	if c.MaxHeaderBytes, err = envInt("HTTP_MAX_HEADER_BYTES", c.MaxHeaderBytes); err != nil {
+		return err
+	}
+	if c.MaxHeaderCount, err = envInt("HTTP_MAX_HEADER_COUNT", c.MaxHeaderCount); err != nil {
+		return err
+	}
+
+	// Read the request target limit from HTTP_MAX_URI_BYTES when set
+	if c.MaxURIBytes, err = envInt("HTTP_MAX_URI_BYTES", c.MaxURIBytes); err != nil {
+		return err
+	}
+
+	// Read the compression threshold from GZIP_MIN_BYTES when set
+	if c.GzipMinBytes, err = envInt("GZIP_MIN_BYTES", c.GzipMinBytes); err != nil {
+		return err
+	}
+
+	// Read the inflated request body limit from MAX_DECOMPRESSED_BODY_BYTES when set
+	if c.MaxDecompressedBodyBytes, err = envInt64("MAX_DECOMPRESSED_BODY_BYTES", c.MaxDecompressedBodyBytes); err != nil {
+		return err
+	}
+
+	// Read the access log format from ACCESS_LOG_FORMAT, validating file values too
+	if c.AccessLogFormat, err = parseAccessLogFormat(envString("ACCESS_LOG_FORMAT", string(c.AccessLogFormat))); err != nil {
+		return err
+	}
+
+	// Read whether to share the port with other processes from HTTP_REUSE_PORT
+	if c.ReusePort, err = envBool("HTTP_REUSE_PORT", c.ReusePort); err != nil {
+		return err
+	}
+
+	// Read the socket tuning from HTTP_LISTEN_BACKLOG and HTTP_TCP_KEEP_ALIVE when set
+	if c.ListenBacklog, err = envInt("HTTP_LISTEN_BACKLOG", c.ListenBacklog); err != nil {
+		return err
+	}
+	if c.TCPKeepAlive, err = envDuration("HTTP_TCP_KEEP_ALIVE", c.TCPKeepAlive); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports every invalid field of the server config
+func (c *ServerConfig) Validate() error {
+	errs := []error{
+		checkOneOf("server.network", c.Network, "tcp", "unix"),
+		checkAddr("server.admin_addr", c.AdminAddr),
+	}
+	if c.Router != "" {
+		errs = append(errs, checkOneOf("server.router", c.Router, "servemux", "chi"))
+	}
+	if c.BasePath != "" && (!strings.HasPrefix(c.BasePath, "/") || strings.HasSuffix(c.BasePath, "/")) {
+		errs = append(errs, fmt.Errorf("server.base_path must start with a slash and not end with one, got %q", c.BasePath))
+	}
+	if c.TrailingSlash != TrailingSlashKeep {
+		errs = append(errs, checkOneOf("server.trailing_slash", string(c.TrailingSlash), string(TrailingSlashStrip), string(TrailingSlashRedirect)))
+	}
+
+	// Check the listen address the network needs, then any extra ones
+	if c.Network == "unix" {
+		errs = append(errs, checkRequired("server.socket_path", c.SocketPath))
+	} else {
+		errs = append(errs, checkAddr("server.addr", c.Addr))
+	}
+	for i, addr := range c.ExtraAddrs {
+		errs = append(errs, checkAddr(fmt.Sprintf("server.extra_addrs[%d]", i), addr))
+	}
+
+	// Timeouts and limits only ever make sense as zero or more
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.startup_timeout", c.StartupTimeout},
+		{"server.shutdown_timeout", c.ShutdownTimeout},
+		{"server.drain_timeout", c.DrainTimeout},
+		{"server.force_close_timeout", c.ForceCloseTimeout},
+		{"server.lame_duck_period", c.LameDuckPeriod},
+		{"server.health_check_timeout", c.HealthCheckTimeout},
+		{"server.concurrency_wait", c.ConcurrencyWait},
+		{"server.read_timeout", c.ReadTimeout},
+		{"server.read_header_timeout", c.ReadHeaderTimeout},
+		{"server.write_timeout", c.WriteTimeout},
+		{"server.idle_timeout", c.IdleTimeout},
+		{"server.listen_retry.initial_backoff", c.ListenRetry.InitialBackoff},
+		{"server.listen_retry.max_backoff", c.ListenRetry.MaxBackoff},
+	} {
+		errs = append(errs, checkNotNegative(d.name, d.value))
+	}
+	errs = append(errs,
+		checkNotNegative("server.max_request_body_bytes", c.MaxRequestBodyBytes),
+		checkNotNegative("server.max_decompressed_body_bytes", c.MaxDecompressedBodyBytes),
+		checkNotNegative("server.max_header_bytes", c.MaxHeaderBytes),
+		checkNotNegative("server.max_response_bytes", c.MaxResponseBytes),
+		checkNotNegative("server.listen_backlog", c.ListenBacklog),
+		checkNotNegative("server.gzip_min_bytes", c.GzipMinBytes),
+	)
+	for pattern, limit := range c.ConcurrencyLimits {
+		errs = append(errs, checkNotNegative(fmt.Sprintf("server.concurrency_limits[%q]", pattern), limit))
+	}
+
+	// The stop sequence must fit in the time the application has to stop
+	if stop := c.LameDuckPeriod + c.DrainTimeout + c.ForceCloseTimeout; c.ShutdownTimeout > 0 && c.ShutdownTimeout < stop {
+		errs = append(errs, fmt.Errorf("server.shutdown_timeout of %v is shorter than the lame duck period, drain and force-close timeouts together (%v)", c.ShutdownTimeout, stop))
+	}
+
+	// TLS needs both halves of the key pair
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("server.tls_cert_file and server.tls_key_file must be set together"))
+	}
+	return errors.Join(errs...)
+}
+
+// NewAdminServerConfig derives the admin server config from the public one,
+// listening on its AdminAddr. The admin server always listens on TCP and
+// isn't connection-limited, so metrics stay reachable under load, and keeps
+// serving while the public server drains.
+func NewAdminServerConfig(cfg ServerConfig) ServerConfig {
+	cfg.Network = "tcp"
+	cfg.MaxConnections = 0
+	cfg.ServeWhileDraining = true
+	cfg.Addr = cfg.AdminAddr
+	if cfg.Addr == "" {
+		cfg.Addr = defaultAdminAddr
+	}
+	cfg.ExtraAddrs = nil
+	cfg.SocketPath = ""
+	cfg.BasePath = ""
+	return cfg
+}
+
+// envString returns the value of an environment variable or a fallback
+func envString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envDuration parses an environment variable as a time.Duration
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return d, nil
+}
+
+// envBool parses an environment variable as a bool
+func envBool(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return b, nil
+}
+
+// envList splits a comma-separated environment variable into its elements
+func envList(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envInt64 parses an environment variable as an int64
+func envInt64(key string, fallback int64) (int64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return n, nil
+}
+
+// envInt parses an environment variable as an int
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return n, nil
+}
+
+// envFloat parses an environment variable as a float64
+func envFloat(key string, fallback float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return f, nil
+}
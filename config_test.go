@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestServerAddrFromEnvironment(t *testing.T) {
+	t.Setenv("HTTP_ADDR", "127.0.0.1:9999")
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != "127.0.0.1:9999" {
+		t.Fatalf("addr %q, want the HTTP_ADDR value", cfg.Server.Addr)
+	}
+}
+
+func TestServerAddrDefault(t *testing.T) {
+	t.Setenv("HTTP_ADDR", "")
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":8080" {
+		t.Fatalf("addr %q, want \":8080\"", cfg.Server.Addr)
+	}
+	if got := (ServerConfig{}).withDefaults().Addr; got != ":8080" {
+		t.Fatalf("empty addr defaults to %q, want \":8080\"", got)
+	}
+}
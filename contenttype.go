@@ -0,0 +1,41 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ContentTypeRoute is an optional interface for routes that only accept
+// request bodies of specific media types, e.g. "application/json"
+type ContentTypeRoute interface {
+	Route
+	ContentTypes() []string
+}
+
+// EnforceContentTypeMiddleware answers 415 to requests whose Content-Type
+// isn't one of the given media types. GET, HEAD, DELETE and OPTIONS
+// requests typically carry no body and are let through.
+func EnforceContentTypeMiddleware(types ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Compare the media type alone, ignoring parameters like charset
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err == nil {
+				for _, t := range types {
+					if strings.EqualFold(mediaType, t) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			RespondError(w, http.StatusUnsupportedMediaType, ErrorCodeUnsupportedMediaType, "Unsupported Content-Type, expected "+strings.Join(types, " or "))
+		})
+	}
+}
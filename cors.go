@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORSConfig holds the cross-origin resource sharing policy
+type CORSConfig struct {
+	// AllowedOrigins lists origins permitted to make requests, "*" for any
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowedMethods lists methods permitted in cross-origin requests
+	AllowedMethods []string `yaml:"allowed_methods"`
+	// AllowCredentials permits cookies and auth headers on cross-origin requests
+	AllowCredentials bool `yaml:"allow_credentials"`
+}
+
+// loadEnv overrides the CORS policy with any values set in the environment
+func (c *CORSConfig) loadEnv() error {
+	c.AllowedOrigins = envList("CORS_ALLOWED_ORIGINS", c.AllowedOrigins)
+	c.AllowedMethods = envList("CORS_ALLOWED_METHODS", c.AllowedMethods)
+
+	// Read whether credentials are allowed from CORS_ALLOW_CREDENTIALS
+	var err error
+	c.AllowCredentials, err = envBool("CORS_ALLOW_CREDENTIALS", c.AllowCredentials)
+	return err
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for an origin
+func (c CORSConfig) allowOrigin(origin string) string {
+	// The wildcard is only valid for requests without credentials
+	if !c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return "*"
+	}
+	if slices.Contains(c.AllowedOrigins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// CORSMiddleware sets Access-Control-* headers and answers preflight requests
+func CORSMiddleware(cfg CORSConfig) Middleware {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Requests without an Origin header are not cross-origin
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Advertise the allowed origin when it matches the policy
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			allowed := cfg.allowOrigin(origin)
+			if allowed != "" {
+				h.Set("Access-Control-Allow-Origin", allowed)
+				if cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			// Short-circuit preflight requests without invoking the route
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				if allowed != "" {
+					h.Set("Access-Control-Allow-Methods", methods)
+					if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+						h.Set("Access-Control-Allow-Headers", reqHeaders)
+					}
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
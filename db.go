@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// defaultDBConnMaxLifetime is how long a pooled connection may be reused
+const defaultDBConnMaxLifetime = 30 * time.Minute
+
+// DBModule provides a *sql.DB opened from the DBConfig and checked on
+// /healthz. The driver isn't linked in by default, so blank-import one
+// alongside the module, e.g.
+//
+//	import _ "github.com/jackc/pgx/v5/stdlib"
+//
+//	fx.New(appOptions(), DBModule)
+var DBModule = fx.Module("db",
+	fx.Provide(
+		NewDB,
+		AsHealthCheck(NewDBChecker),
+	),
+)
+
+// DBConfig holds the configuration for the SQL database
+type DBConfig struct {
+	// Driver is the name the database/sql driver registered under
+	Driver string `yaml:"driver"`
+	// DSN is the driver-specific data source name
+	DSN string `yaml:"dsn" sensitive:"true"`
+	// MaxOpenConns caps the open connections, zero leaves them unlimited
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// MaxIdleConns caps the idle connections kept in the pool
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// ConnMaxLifetime is how long a connection may be reused, zero forever
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// loadEnv overrides the database config with any values set in the environment
+func (c *DBConfig) loadEnv() error {
+	c.Driver = envString("DB_DRIVER", c.Driver)
+	c.DSN = envString("DB_DSN", c.DSN)
+	var err error
+	if c.MaxOpenConns, err = envInt("DB_MAX_OPEN_CONNS", c.MaxOpenConns); err != nil {
+		return err
+	}
+	if c.MaxIdleConns, err = envInt("DB_MAX_IDLE_CONNS", c.MaxIdleConns); err != nil {
+		return err
+	}
+	if c.ConnMaxLifetime, err = envDuration("DB_CONN_MAX_LIFETIME", c.ConnMaxLifetime); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a DSN without a driver and negative pool limits
+func (c *DBConfig) Validate() error {
+	errs := []error{
+		checkNotNegative("db.max_open_conns", c.MaxOpenConns),
+		checkNotNegative("db.max_idle_conns", c.MaxIdleConns),
+		checkNotNegative("db.conn_max_lifetime", c.ConnMaxLifetime),
+	}
+	if c.DSN != "" {
+		errs = append(errs, checkRequired("db.driver", c.Driver))
+	}
+	return errors.Join(errs...)
+}
+
+// NewDB opens the database with the configured pool limits, pinging it on
+// start so the app refuses to run without a reachable database, and closes
+// it on stop
+func NewDB(cfg DBConfig, lc fx.Lifecycle, log *zap.Logger) (*sql.DB, error) {
+	if cfg.Driver == "" || cfg.DSN == "" {
+		return nil, errors.New("a database driver and DSN are required")
+	}
+
+	// Opening only validates the arguments, connecting waits for the ping
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", cfg.Driver, err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if err := db.PingContext(ctx); err != nil {
+				// Release the pool, since OnStop won't run for a failed start
+				_ = db.Close()
+				return fmt.Errorf("failed to reach %s database: %w", cfg.Driver, err)
+			}
+			log.Info("Connected to database", zap.String("driver", cfg.Driver), zap.Int("max_open_conns", cfg.MaxOpenConns))
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			return db.Close()
+		},
+	})
+	return db, nil
+}
+
+// DBChecker reports whether the database answers a ping
+type DBChecker struct {
+	db *sql.DB
+}
+
+// NewDBChecker creates a DBChecker for db
+func NewDBChecker(db *sql.DB) *DBChecker {
+	return &DBChecker{db: db}
+}
+
+// Name identifies the DBChecker in the health response
+func (*DBChecker) Name() string {
+	return "database"
+}
+
+// Check pings the database
+func (c *DBChecker) Check(ctx context.Context) error {
+	return c.db.PingContext(ctx)
+}
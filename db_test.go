@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// testDriver is a database/sql driver whose connections fail to open when
+// the DSN is "unreachable"
+type testDriver struct{}
+
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+	if dsn == "unreachable" {
+		return nil, errors.New("connection refused")
+	}
+	return testConn{}, nil
+}
+
+// testConn is a connection of the testDriver that only supports closing
+type testConn struct{}
+
+func (testConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (testConn) Close() error                        { return nil }
+func (testConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func init() {
+	sql.Register("fxdemo-test", testDriver{})
+}
+
+func TestDBOpensOnStartAndClosesOnStop(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	db, err := NewDB(DBConfig{Driver: "fxdemo-test", DSN: "ok", MaxOpenConns: 2}, lc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc.RequireStart()
+	if err := db.Ping(); err != nil {
+		t.Fatalf("ping after start: %v", err)
+	}
+	if got := db.Stats().MaxOpenConnections; got != 2 {
+		t.Errorf("max open conns %d, want 2", got)
+	}
+	lc.RequireStop()
+	if err := db.Ping(); err == nil {
+		t.Fatal("database still open after stop")
+	}
+}
+
+func TestDBClosedWhenPingFails(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	db, err := NewDB(DBConfig{Driver: "fxdemo-test", DSN: "unreachable"}, lc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.Start(context.Background()); err == nil {
+		t.Fatal("start succeeded with an unreachable database")
+	}
+
+	// The failed start released the pool even though OnStop never runs
+	if err := db.Ping(); err == nil || err.Error() != "sql: database is closed" {
+		t.Fatalf("ping after failed start: %v, want the database closed", err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// requestTimeoutHeader carries the caller's deadline for the request
+	requestTimeoutHeader = "X-Request-Timeout"
+	// maxRequestDeadline is the longest deadline a caller may ask for
+	maxRequestDeadline = 30 * time.Second
+)
+
+// DeadlineMiddleware applies the deadline from an X-Request-Timeout header,
+// e.g. "2s", to the request context so handlers can honor r.Context().Done()
+func DeadlineMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Requests without the header keep their existing context
+			v := r.Header.Get(requestTimeoutHeader)
+			if v == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Reject malformed, non-positive and abusive durations
+			timeout, err := time.ParseDuration(v)
+			if err != nil || timeout <= 0 || timeout > maxRequestDeadline {
+				RespondError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Invalid "+requestTimeoutHeader+" header")
+				return
+			}
+
+			// Serve the request with the requested deadline
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
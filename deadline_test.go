@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeadlineMiddlewareSetsDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	h := DeadlineMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestTimeoutHeader, "2s")
+	before := time.Now()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	after := time.Now()
+	if !ok {
+		t.Fatal("no deadline on the request context")
+	}
+	if deadline.Before(before.Add(2*time.Second)) || deadline.After(after.Add(2*time.Second)) {
+		t.Fatalf("deadline %v after the request, want 2s", deadline.Sub(before))
+	}
+}
+
+func TestDeadlineMiddlewareRejectsInvalidTimeouts(t *testing.T) {
+	h := DeadlineMiddleware()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("handler ran for an invalid timeout")
+	}))
+	for _, v := range []string{"soon", "-1s", "0s", "31s"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(requestTimeoutHeader, v)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %q = %d, want 400", requestTimeoutHeader, v, rec.Code)
+		}
+	}
+}
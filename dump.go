@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httputil"
+
+	"go.uber.org/zap"
+)
+
+// defaultDumpMaxBodyBytes caps how much of each request body is dumped
+const defaultDumpMaxBodyBytes = 64 << 10
+
+// DumpConfig controls logging full requests for debugging, off by default
+type DumpConfig struct {
+	// Enabled logs every request, headers and body, at Debug level
+	Enabled bool `yaml:"enabled"`
+	// MaxBodyBytes caps the dumped part of each body, the handler still
+	// receives all of it
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// RedactHeaders lists headers whose values are masked in the dump
+	RedactHeaders []string `yaml:"redact_headers"`
+}
+
+// loadEnv overrides the dump config with any values set in the environment
+func (c *DumpConfig) loadEnv() error {
+	c.RedactHeaders = envList("REQUEST_DUMP_REDACT_HEADERS", c.RedactHeaders)
+	var err error
+	if c.Enabled, err = envBool("REQUEST_DUMP", c.Enabled); err != nil {
+		return err
+	}
+	if c.MaxBodyBytes, err = envInt64("REQUEST_DUMP_MAX_BODY_BYTES", c.MaxBodyBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a negative body cap
+func (c *DumpConfig) Validate() error {
+	return checkNotNegative("dump.max_body_bytes", c.MaxBodyBytes)
+}
+
+// DumpMiddleware logs each request with httputil.DumpRequest at Debug level,
+// masking the redacted headers and capping the body. The part of the body
+// read for the dump is put back in front of the rest, so the route still
+// reads the whole body.
+func DumpMiddleware(cfg DumpConfig, log *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Skip the work whenever the level in force would drop the dump
+			if !log.Core().Enabled(zap.DebugLevel) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Read one byte past the cap to tell whether the body was cut short
+			var head []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				var err error
+				head, err = io.ReadAll(io.LimitReader(r.Body, cfg.MaxBodyBytes+1))
+				if err != nil {
+					log.Debug("Failed to read request body for dump", zap.Error(err))
+				}
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+			}
+			truncated := int64(len(head)) > cfg.MaxBodyBytes
+			if truncated {
+				head = head[:cfg.MaxBodyBytes]
+			}
+
+			// Dump a copy carrying the redacted headers and the captured body
+			dumped := r.Clone(r.Context())
+			for _, name := range cfg.RedactHeaders {
+				if dumped.Header.Get(name) != "" {
+					dumped.Header.Set(name, "REDACTED")
+				}
+			}
+			dumped.Body = io.NopCloser(bytes.NewReader(head))
+			dumped.ContentLength = int64(len(head))
+			dump, err := httputil.DumpRequest(dumped, true)
+			if err != nil {
+				log.Debug("Failed to dump request", zap.Error(err))
+			} else {
+				log.Debug("Dumped request",
+					zap.String("request_id", RequestIDFromContext(r.Context())),
+					zap.ByteString("dump", dump),
+					zap.Bool("body_truncated", truncated),
+				)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// readCloser reads from one reader and closes another, here the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
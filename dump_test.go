@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDumpKeepsBodyReadable(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	cfg := DumpConfig{Enabled: true, MaxBodyBytes: 8, RedactHeaders: []string{"Authorization"}}
+	body := "a body longer than the dump cap"
+	var got string
+	h := DumpMiddleware(cfg, zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got = string(b)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	// The handler reads the whole body even though the dump was capped
+	if got != body {
+		t.Fatalf("handler read %q, want %q", got, body)
+	}
+	entries := logs.FilterMessage("Dumped request").All()
+	if len(entries) != 1 {
+		t.Fatalf("%d dumps logged, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	dump, _ := fields["dump"].(string)
+	if !strings.Contains(dump, "Authorization: REDACTED") || strings.Contains(dump, "secret") {
+		t.Errorf("dump %q doesn't redact the Authorization header", dump)
+	}
+	if !strings.HasSuffix(dump, body[:8]) || fields["body_truncated"] != true {
+		t.Errorf("dump %q, truncated %v, want the body cut at 8 bytes", dump, fields["body_truncated"])
+	}
+}
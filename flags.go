@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ParseFlags parses command-line flags and merges them over the config
+// loaded from the file and environment, so flags take precedence over
+// environment variables, which take precedence over the file. The file is
+// named by -config, falling back to CONFIG_FILE.
+func ParseFlags(args []string) (*AppConfig, error) {
+	fs := flag.NewFlagSet("fxdemo", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or JSON config file")
+
+	// Record each flag as an override, applied only when it is actually set
+	var overrides []func(*AppConfig)
+	str := func(name, usage string, field func(*AppConfig) *string) {
+		fs.Func(name, usage, func(s string) error {
+			overrides = append(overrides, func(c *AppConfig) { *field(c) = s })
+			return nil
+		})
+	}
+	dur := func(name, usage string, field func(*AppConfig) *time.Duration) {
+		fs.Func(name, usage, func(s string) error {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			overrides = append(overrides, func(c *AppConfig) { *field(c) = d })
+			return nil
+		})
+	}
+	boolean := func(name, usage string, field func(*AppConfig) *bool) {
+		fs.BoolFunc(name, usage, func(s string) error {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return err
+			}
+			overrides = append(overrides, func(c *AppConfig) { *field(c) = b })
+			return nil
+		})
+	}
+	str("http-network", `listener network, "tcp" or "unix"`, func(c *AppConfig) *string { return &c.Server.Network })
+	str("http-addr", "TCP address of the public server", func(c *AppConfig) *string { return &c.Server.Addr })
+	str("admin-addr", "TCP address of the admin server", func(c *AppConfig) *string { return &c.Server.AdminAddr })
+	str("socket-path", "Unix socket path of the public server", func(c *AppConfig) *string { return &c.Server.SocketPath })
+	str("router", `router implementation, "servemux" or "chi"`, func(c *AppConfig) *string { return &c.Server.Router })
+	str("tls-cert", "TLS certificate file, enabling HTTPS", func(c *AppConfig) *string { return &c.Server.TLSCertFile })
+	str("tls-key", "TLS private key file, enabling HTTPS", func(c *AppConfig) *string { return &c.Server.TLSKeyFile })
+	dur("startup-timeout", "how long the application may take to start", func(c *AppConfig) *time.Duration { return &c.Server.StartupTimeout })
+	dur("shutdown-timeout", "how long the application may take to stop", func(c *AppConfig) *time.Duration { return &c.Server.ShutdownTimeout })
+	dur("drain-timeout", "how long to wait for connections to drain on stop", func(c *AppConfig) *time.Duration { return &c.Server.DrainTimeout })
+	dur("force-close-timeout", "how long to wait for requests after force-closing connections", func(c *AppConfig) *time.Duration { return &c.Server.ForceCloseTimeout })
+	dur("lame-duck-period", "how long to keep serving after readiness flips on stop", func(c *AppConfig) *time.Duration { return &c.Server.LameDuckPeriod })
+	dur("request-timeout", "how long a route may run before a 503", func(c *AppConfig) *time.Duration { return &c.Server.RequestTimeout })
+	str("log-level", "minimum log level", func(c *AppConfig) *string { return &c.Log.Level })
+	str("log-encoding", `log encoding, "json" or "console"`, func(c *AppConfig) *string { return &c.Log.Encoding })
+	boolean("enable-pprof", "expose /debug/pprof on the admin server", func(c *AppConfig) *bool { return &c.Features.EnablePprof })
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %q", fs.Args())
+	}
+
+	// Load the file and environment, then let the flags win
+	cfg, err := LoadConfig(*path)
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		override(cfg)
+	}
+	return cfg, nil
+}
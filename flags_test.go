@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFlagsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := `
+server:
+  addr: "127.0.0.1:1111"
+  shutdown_timeout: 40s
+log:
+  level: warn
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("HTTP_ADDR", "127.0.0.1:2222")
+	t.Setenv("LOG_LEVEL", "error")
+	t.Setenv("SHUTDOWN_TIMEOUT", "")
+
+	cfg, err := ParseFlags([]string{"-http-addr", "127.0.0.1:3333"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags beat the environment, which beats the file, which beats the defaults
+	if cfg.Server.Addr != "127.0.0.1:3333" {
+		t.Errorf("addr %q, want the flag value", cfg.Server.Addr)
+	}
+	if cfg.Log.Level != "error" {
+		t.Errorf("log level %q, want the environment value", cfg.Log.Level)
+	}
+	if cfg.Server.ShutdownTimeout != 40*time.Second {
+		t.Errorf("shutdown timeout %v, want the file value", cfg.Server.ShutdownTimeout)
+	}
+	if cfg.Server.DrainTimeout != defaultDrainTimeout {
+		t.Errorf("drain timeout %v, want the default", cfg.Server.DrainTimeout)
+	}
+}
+
+func TestParseFlagsRejectsBadInput(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	for _, args := range [][]string{
+		{"-shutdown-timeout", "soon"},
+		{"-no-such-flag"},
+		{"stray"},
+	} {
+		if _, err := ParseFlags(args); err == nil {
+			t.Errorf("ParseFlags(%q) succeeded, want an error", args)
+		}
+	}
+}
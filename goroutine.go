@@ -0,0 +1,30 @@
+package main
+
+import (
+	"runtime/debug"
+
+	"go.uber.org/zap"
+)
+
+// SafeGo runs fn in a new goroutine, recovering and logging any panic so it
+// cannot crash the process. RecoveryMiddleware only guards the goroutine
+// serving the request, so handlers must launch their own goroutines, such as
+// the background work of an async route, through SafeGo:
+//
+//	SafeGo(h.log, func() {
+//		h.process(job)
+//	})
+func SafeGo(log *zap.Logger, fn func()) {
+	go func() {
+		defer func() {
+			// Log the panic value together with the goroutine stack
+			if rec := recover(); rec != nil {
+				log.Error("Recovered from panic in goroutine",
+					zap.Any("panic", rec),
+					zap.ByteString("stack", debug.Stack()),
+				)
+			}
+		}()
+		fn()
+	}()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSafeGoRecoversAndLogsPanics(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	SafeGo(zap.New(core), func() {
+		panic("boom")
+	})
+
+	// The panic is logged instead of crashing the test binary
+	deadline := time.Now().Add(2 * time.Second)
+	for logs.Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("panic in SafeGo wasn't logged")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	entry := logs.All()[0]
+	if entry.Message != "Recovered from panic in goroutine" || entry.ContextMap()["panic"] != "boom" {
+		t.Fatalf("logged %q %v, want the recovered panic", entry.Message, entry.ContextMap())
+	}
+	if _, ok := entry.ContextMap()["stack"]; !ok {
+		t.Error("no stack logged with the panic")
+	}
+}
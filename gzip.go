@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GzipMiddleware compresses responses of at least minSize bytes for clients accepting gzip
+func GzipMiddleware(minSize int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The response varies on whether the client accepts gzip
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) || isUpgradeRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Always finish the response, even if the handler panics or fails
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize}
+			defer gw.Close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.EqualFold(strings.TrimSpace(name), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the response until it reaches the minimum size,
+// then either compresses it or, if it stays small, writes it as-is
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	status  int
+	buf     []byte
+	gz      *gzip.Writer
+	plain   bool
+}
+
+// WriteHeader defers the status until we know whether to compress
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write buffers small responses and compresses once the threshold is reached
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.plain:
+		return w.ResponseWriter.Write(b)
+	}
+
+	// Keep buffering until the response is large enough to be worth compressing
+	w.buf = append(w.buf, b...)
+	if len(w.buf) < w.minSize {
+		return len(b), nil
+	}
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// start commits the headers and flushes the buffer through the chosen encoder
+func (w *gzipResponseWriter) start() error {
+	// Detect the content type from the uncompressed bytes before encoding
+	h := w.ResponseWriter.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	// Handlers that already encode their body or send nothing are left alone
+	if h.Get("Content-Encoding") != "" || len(w.buf) == 0 || len(w.buf) < w.minSize {
+		w.plain = true
+	} else {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+
+	// Send the deferred status and whatever was buffered so far
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends buffered data to the client, compressing it if already started
+func (w *gzipResponseWriter) Flush() {
+	if w.gz == nil && !w.plain {
+		if err := w.start(); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	// Reach the connection through any wrappers that only expose Unwrap
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Close writes any buffered data and terminates the gzip stream
+func (w *gzipResponseWriter) Close() error {
+	if w.gz == nil && !w.plain {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
+
+// DecompressMiddleware inflates gzip-encoded request bodies so routes read
+// plain data. The body is inflated up front, up to maxSize bytes, so an
+// oversized or corrupt body is answered with a 413 or 400 before the route
+// runs, which also defuses zip bombs. Other content codings get a 415.
+func DecompressMiddleware(maxSize int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+			default:
+				w.Header().Set("Accept-Encoding", "gzip")
+				RespondError(w, http.StatusUnsupportedMediaType, ErrorCodeUnsupportedMediaType, "Unsupported Content-Encoding "+enc)
+				return
+			}
+
+			// Inflate one byte past the limit to tell a full body from an oversized one
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				RespondError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Malformed gzip body")
+				return
+			}
+			defer zr.Close()
+			body, err := io.ReadAll(io.LimitReader(zr, maxSize+1))
+			if err != nil {
+				RespondError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Malformed gzip body")
+				return
+			}
+			if int64(len(body)) > maxSize {
+				RespondError(w, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge, "Decompressed request body too large")
+				return
+			}
+
+			// Hand the route the plain body as if it had been sent uncompressed
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// gzipped compresses s
+func gzipped(t *testing.T, s string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestDecompressGzipRequestToEcho(t *testing.T) {
+	echo := newTestMux(t, defaultServerConfig(), NewEchoHandler(zap.NewNop(), EchoConfig{}))
+	h := DecompressMiddleware(64)(echo)
+
+	// The echo reads the inflated body
+	req := httptest.NewRequest(http.MethodPost, "/echo", gzipped(t, "hello, gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello, gzip" {
+		t.Fatalf("POST /echo = %d %q, want 200 with the plain body", rec.Code, rec.Body.String())
+	}
+
+	// A body inflating past the limit is rejected before the echo runs
+	req = httptest.NewRequest(http.MethodPost, "/echo", gzipped(t, strings.Repeat("a", 1024)))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized gzip body = %d, want 413", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Code != ErrorCodeRequestTooLarge {
+		t.Errorf("error code %q, want %q", e.Code, ErrorCodeRequestTooLarge)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "net/http"
+
+// HeaderLimitMiddleware rejects requests carrying more than max header
+// fields with a 431, heading off header floods that stay under the server's
+// MaxHeaderBytes. Zero or negative disables the check.
+func HeaderLimitMiddleware(max int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Count every value, since repeated fields are folded into one key
+			count := 0
+			for _, values := range r.Header {
+				count += len(values)
+			}
+			if count > max {
+				RespondError(w, http.StatusRequestHeaderFieldsTooLarge, ErrorCodeHeadersTooLarge, "Too many request header fields")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
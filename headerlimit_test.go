@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderLimitRejectsHeaderFloods(t *testing.T) {
+	h := HeaderLimitMiddleware(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for count, want := range map[int]int{5: http.StatusNoContent, 50: http.StatusRequestHeaderFieldsTooLarge} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for i := range count {
+			// Repeated fields count once per value
+			req.Header.Add("X-Flood", fmt.Sprint(i))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%d headers = %d, want %d", count, rec.Code, want)
+		}
+		if want != http.StatusNoContent {
+			if e := decodeError(t, rec); e.Code != ErrorCodeHeadersTooLarge {
+				t.Errorf("error code %q, want %q", e.Code, ErrorCodeHeadersTooLarge)
+			}
+		}
+	}
+}
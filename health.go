@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// healthResponse is the JSON body returned by the HealthHandler
+type healthResponse struct {
+	Status   string                 `json:"status"`
+	InFlight int64                  `json:"in_flight"`
+	Checks   map[string]checkResult `json:"checks,omitempty"`
+}
+
+// HealthHandler is an HTTP handler that reports liveness together with the
+// status of every registered HealthChecker
+type HealthHandler struct {
+	log      *zap.Logger
+	inFlight *InFlight
+	checkers []HealthChecker
+	timeout  time.Duration
+}
+
+// healthHandlerParams holds the dependencies of the HealthHandler
+type healthHandlerParams struct {
+	fx.In
+
+	Log      *zap.Logger
+	InFlight *InFlight
+	Config   ServerConfig
+	Checkers []HealthChecker `group:"healthchecks"`
+}
+
+// NewHealthHandler creates a new HealthHandler instance
+func NewHealthHandler(p healthHandlerParams) *HealthHandler {
+	return &HealthHandler{
+		log:      p.Log,
+		inFlight: p.InFlight,
+		checkers: p.Checkers,
+		timeout:  p.Config.withDefaults().HealthCheckTimeout,
+	}
+}
+
+// Pattern returns the URL pattern for the HealthHandler
+func (*HealthHandler) Pattern() string {
+	return "/healthz"
+}
+
+// ServeHTTP implements the HTTP handler for HealthHandler
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Run the checks and answer 503 unless every one of them passes
+	checks, healthy := runHealthChecks(r.Context(), h.checkers, h.timeout)
+	resp := healthResponse{Status: "ok", InFlight: h.inFlight.Count(), Checks: checks}
+	status := http.StatusOK
+	if !healthy {
+		resp.Status = "fail"
+		status = http.StatusServiceUnavailable
+		h.log.Warn("Health check failed", zap.Any("checks", checks))
+	}
+	WriteJSON(w, status, resp)
+}
+
+// ReadinessState tracks whether the server is ready to accept traffic and
+// whether it has begun shutting down
+type ReadinessState struct {
+	ready        atomic.Bool
+	shuttingDown atomic.Bool
+	closeOnce    sync.Once
+	done         chan struct{}
+	// shutdownStart is when shutdown began, in Unix nanoseconds
+	shutdownStart atomic.Int64
+}
+
+// NewReadinessState creates a ReadinessState that starts out not ready
+func NewReadinessState() *ReadinessState {
+	return &ReadinessState{done: make(chan struct{})}
+}
+
+// SetReady updates whether the server is ready to accept traffic
+func (s *ReadinessState) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+// Ready reports whether the server is ready to accept traffic
+func (s *ReadinessState) Ready() bool {
+	return s.ready.Load()
+}
+
+// SetShuttingDown records that shutdown has begun, which is never undone
+func (s *ReadinessState) SetShuttingDown() {
+	s.closeOnce.Do(func() {
+		s.shutdownStart.Store(time.Now().UnixNano())
+		close(s.done)
+	})
+	s.shuttingDown.Store(true)
+}
+
+// ShutdownStarted returns when shutdown began, or false if it hasn't
+func (s *ReadinessState) ShutdownStarted() (time.Time, bool) {
+	start := s.shutdownStart.Load()
+	if start == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, start), true
+}
+
+// Done returns a channel closed once shutdown has begun, letting long-lived
+// responses end before the server waits for them to drain
+func (s *ReadinessState) Done() <-chan struct{} {
+	return s.done
+}
+
+// ShuttingDown reports whether shutdown has begun
+func (s *ReadinessState) ShuttingDown() bool {
+	return s.shuttingDown.Load()
+}
+
+// ShutdownMiddleware answers 503 to requests arriving once shutdown has
+// begun, asking the client to reconnect elsewhere, while requests already
+// past it run to completion. Servers that serve while draining, like the
+// admin server, are let through.
+func ShutdownMiddleware(state *ReadinessState) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if state.ShuttingDown() && !servesWhileDraining(r.Context()) {
+				w.Header().Set("Connection", "close")
+				RespondError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Server is shutting down")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ReadinessHandler is an HTTP handler that reports readiness
+type ReadinessHandler struct {
+	log   *zap.Logger
+	state *ReadinessState
+}
+
+// NewReadinessHandler creates a new ReadinessHandler instance
+func NewReadinessHandler(log *zap.Logger, state *ReadinessState) *ReadinessHandler {
+	return &ReadinessHandler{log: log, state: state}
+}
+
+// Pattern returns the URL pattern for the ReadinessHandler
+func (*ReadinessHandler) Pattern() string {
+	return "/readyz"
+}
+
+// ServeHTTP implements the HTTP handler for ReadinessHandler
+func (h *ReadinessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Report 503 until the server has finished starting up
+	if !h.state.Ready() {
+		RespondError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Not ready")
+		return
+	}
+	if err := WriteJSON(w, http.StatusOK, map[string]string{"status": "ready"}); err != nil {
+		h.log.Warn("Failed to write readiness response", zap.Error(err))
+	}
+}
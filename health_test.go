@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	state := NewReadinessState()
+	h := NewReadinessHandler(zap.NewNop(), state)
+
+	// Not ready until the server starts, answered with the error envelope
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	if got := decodeError(t, rec); got.Code != ErrorCodeUnavailable {
+		t.Fatalf("code = %q, want %q", got.Code, ErrorCodeUnavailable)
+	}
+
+	state.SetReady(true)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"status":"ready"}`+"\n" {
+		t.Fatalf("got %d %q, want 200 ready", rec.Code, rec.Body.String())
+	}
+}
+
+func TestShutdownMiddlewareTurnsAwayNewRequests(t *testing.T) {
+	state := NewReadinessState()
+	h := ShutdownMiddleware(state)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("before shutdown: %d, want 204", rec.Code)
+	}
+
+	// Once shutdown begins new requests get a 503 asking them to reconnect
+	state.SetShuttingDown()
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Connection") != "close" {
+		t.Fatalf("during shutdown: %d Connection %q, want 503 and close", rec.Code, rec.Header().Get("Connection"))
+	}
+	if got := decodeError(t, rec); got.Code != ErrorCodeUnavailable {
+		t.Fatalf("code = %q, want %q", got.Code, ErrorCodeUnavailable)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+// defaultMaxGoroutines is the goroutine count the GoroutineChecker fails above
+const defaultMaxGoroutines = 10000
+
+// HealthChecker reports the health of a dependency on /healthz
+type HealthChecker interface {
+	// Name identifies the check in the health response
+	Name() string
+	// Check returns an error when the dependency is unhealthy
+	Check(ctx context.Context) error
+}
+
+// AsHealthCheck annotates a function as a HealthChecker run by the HealthHandler
+func AsHealthCheck(f any) any {
+	return fx.Annotate(
+		f,
+		fx.As(new(HealthChecker)),
+		fx.ResultTags(`group:"healthchecks"`),
+	)
+}
+
+// checkResult is the outcome of a single health check
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runHealthChecks runs every checker concurrently, each bounded by timeout,
+// and reports whether all of them passed
+func runHealthChecks(ctx context.Context, checkers []HealthChecker, timeout time.Duration) (map[string]checkResult, bool) {
+	if len(checkers) == 0 {
+		return nil, true
+	}
+	results := make([]error, len(checkers))
+	var wg sync.WaitGroup
+	for i, checker := range checkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, checker, timeout)
+		}()
+	}
+	wg.Wait()
+
+	// Collect the results by name now that every check has finished
+	checks := make(map[string]checkResult, len(checkers))
+	healthy := true
+	for i, checker := range checkers {
+		if err := results[i]; err != nil {
+			checks[checker.Name()] = checkResult{Status: "fail", Error: err.Error()}
+			healthy = false
+			continue
+		}
+		checks[checker.Name()] = checkResult{Status: "ok"}
+	}
+	return checks, healthy
+}
+
+// runHealthCheck runs one check, failing it once the timeout passes even if
+// the checker ignores its context, and turning a panic into a failure
+func runHealthCheck(ctx context.Context, checker HealthChecker, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("check panicked: %v", rec)
+			}
+		}()
+		done <- checker.Check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
+
+// GoroutineChecker fails when the goroutine count suggests a leak
+type GoroutineChecker struct {
+	max int
+}
+
+// NewGoroutineChecker creates a GoroutineChecker with the default limit
+func NewGoroutineChecker() *GoroutineChecker {
+	return &GoroutineChecker{max: defaultMaxGoroutines}
+}
+
+// Name identifies the GoroutineChecker in the health response
+func (*GoroutineChecker) Name() string {
+	return "goroutines"
+}
+
+// Check fails when more goroutines are running than the limit allows
+func (c *GoroutineChecker) Check(context.Context) error {
+	if n := runtime.NumGoroutine(); n > c.max {
+		return fmt.Errorf("%d goroutines running, limit is %d", n, c.max)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stubChecker is a HealthChecker returning err, or blocking until its
+// context ends when hang is set
+type stubChecker struct {
+	name string
+	err  error
+	hang bool
+}
+
+func (c stubChecker) Name() string { return c.name }
+
+func (c stubChecker) Check(ctx context.Context) error {
+	if c.hang {
+		<-ctx.Done()
+	}
+	return c.err
+}
+
+// serveHealth runs the HealthHandler with checkers and decodes its response
+func serveHealth(t *testing.T, checkers ...HealthChecker) (int, healthResponse) {
+	t.Helper()
+	cfg := defaultServerConfig()
+	cfg.HealthCheckTimeout = 50 * time.Millisecond
+	h := NewHealthHandler(healthHandlerParams{Log: zap.NewNop(), InFlight: NewInFlight(), Config: cfg, Checkers: checkers})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var resp healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, resp
+}
+
+func TestHealthReportsEveryCheck(t *testing.T) {
+	status, resp := serveHealth(t,
+		stubChecker{name: "cache"},
+		stubChecker{name: "database", err: errors.New("connection refused")},
+	)
+	if status != http.StatusServiceUnavailable || resp.Status != "fail" {
+		t.Fatalf("got %d %q, want 503 fail", status, resp.Status)
+	}
+	if got := resp.Checks["cache"]; got.Status != "ok" {
+		t.Errorf("cache check %+v, want ok", got)
+	}
+	if got := resp.Checks["database"]; got.Status != "fail" || got.Error != "connection refused" {
+		t.Errorf("database check %+v, want the failure", got)
+	}
+
+	// All checks passing answers 200
+	if status, resp := serveHealth(t, stubChecker{name: "cache"}, NewGoroutineChecker()); status != http.StatusOK || resp.Status != "ok" {
+		t.Fatalf("got %d %q, want 200 ok", status, resp.Status)
+	}
+}
+
+func TestHealthCheckTimesOut(t *testing.T) {
+	start := time.Now()
+	status, resp := serveHealth(t, stubChecker{name: "slow", hang: true})
+	if status != http.StatusServiceUnavailable || resp.Checks["slow"].Status != "fail" {
+		t.Fatalf("got %d %+v, want the slow check failed", status, resp.Checks)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("health took %s, want the check cut off at its timeout", elapsed)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// HTTPSRedirectConfig controls redirecting plain HTTP requests to HTTPS,
+// off by default
+type HTTPSRedirectConfig struct {
+	// Enabled redirects every request not made over HTTPS
+	Enabled bool `yaml:"enabled"`
+	// TrustForwardedProto takes the scheme from X-Forwarded-Proto when the
+	// peer is a trusted proxy, for servers behind a TLS-terminating proxy
+	TrustForwardedProto bool `yaml:"trust_forwarded_proto"`
+	// Port is the HTTPS port to redirect to, empty keeps the request's host
+	// as it is
+	Port string `yaml:"port"`
+	// ExemptPaths are served over plain HTTP, such as probes and scrapes.
+	// Paths ending in a slash exempt the whole subtree.
+	ExemptPaths []string `yaml:"exempt_paths"`
+}
+
+// loadEnv overrides the HTTPS redirect config with any values set in the
+// environment
+func (c *HTTPSRedirectConfig) loadEnv() error {
+	c.Port = envString("HTTPS_REDIRECT_PORT", c.Port)
+	c.ExemptPaths = envList("HTTPS_REDIRECT_EXEMPT_PATHS", c.ExemptPaths)
+	var err error
+	if c.Enabled, err = envBool("HTTPS_REDIRECT", c.Enabled); err != nil {
+		return err
+	}
+	if c.TrustForwardedProto, err = envBool("HTTPS_REDIRECT_TRUST_FORWARDED_PROTO", c.TrustForwardedProto); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a malformed redirect port
+func (c *HTTPSRedirectConfig) Validate() error {
+	if c.Port == "" {
+		return nil
+	}
+	return checkAddr("https_redirect.port", net.JoinHostPort("", c.Port))
+}
+
+// checkForwardedProto reports trusting X-Forwarded-Proto without any trusted
+// proxy to send it, which would redirect every proxied request forever
+func checkForwardedProto(cfg HTTPSRedirectConfig, proxy ProxyConfig) error {
+	if cfg.Enabled && cfg.TrustForwardedProto && len(proxy.TrustedProxies) == 0 {
+		return errors.New("https_redirect.trust_forwarded_proto needs proxy.trusted_proxies to be set")
+	}
+	return nil
+}
+
+// isHTTPS reports whether r arrived over HTTPS, either directly or, when
+// trustForwardedProto is set, through a trusted proxy reporting it in
+// X-Forwarded-Proto. The header is ignored from other peers, so clients
+// can't skip the redirect by sending it themselves.
+func isHTTPS(r *http.Request, trustForwardedProto bool, trustedProxies []net.IPNet) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !trustForwardedProto {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !trusts(trustedProxies, ip) {
+		return false
+	}
+
+	// The proxy closest to the client adds the first entry
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// HTTPSRedirectMiddleware answers requests not made over HTTPS with a 308 to
+// the same URL on https://, keeping the method and body. Exempt paths are
+// served as they are.
+func HTTPSRedirectMiddleware(cfg HTTPSRedirectConfig, trustedProxies TrustedProxies) Middleware {
+	// Split the exempt paths into exact matches and subtrees once
+	var exact, subtrees []string
+	for _, p := range cfg.ExemptPaths {
+		if strings.HasSuffix(p, "/") {
+			subtrees = append(subtrees, p)
+		} else {
+			exact = append(exact, p)
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		if !cfg.Enabled {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isHTTPS(r, cfg.TrustForwardedProto, trustedProxies) ||
+				slices.Contains(exact, r.URL.Path) || underSubtree(r.URL.Path, subtrees) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			target := "https://" + httpsHost(r.Host, cfg.Port) + r.URL.RequestURI()
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+		})
+	}
+}
+
+// httpsHost returns the host to redirect to, moving host to port when one is
+// configured and dropping it for the default 443. IPv6 literals keep their
+// brackets whether or not a port follows.
+func httpsHost(host, port string) string {
+	if port == "" {
+		return host
+	}
+
+	// Strip any port, leaving a bracketed IPv6 literal whole
+	name := host
+	if strings.HasPrefix(host, "[") {
+		if i := strings.IndexByte(host, ']'); i >= 0 {
+			name = host[:i+1]
+		}
+	} else if i := strings.LastIndexByte(host, ':'); i >= 0 && strings.Count(host, ":") == 1 {
+		name = host[:i]
+	} else if strings.Contains(host, ":") {
+		name = "[" + host + "]"
+	}
+	if port == "443" {
+		return name
+	}
+	return name + ":" + port
+}
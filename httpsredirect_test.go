@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// redirectTo serves r through the HTTPS redirect and returns the status
+// and any redirect target
+func redirectTo(t *testing.T, cfg HTTPSRedirectConfig, r *http.Request) (int, string) {
+	t.Helper()
+	proxies, err := NewTrustedProxies(ProxyConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := HTTPSRedirectMiddleware(cfg, proxies)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec.Code, rec.Header().Get("Location")
+}
+
+func TestHTTPSRedirectDetectsDirectTLS(t *testing.T) {
+	cfg := HTTPSRedirectConfig{Enabled: true, Port: "8443"}
+
+	// Plain HTTP is sent to the same URL on the HTTPS port
+	r := httptest.NewRequest(http.MethodPost, "http://example.com:8080/hello?x=1", nil)
+	if code, loc := redirectTo(t, cfg, r); code != http.StatusPermanentRedirect || loc != "https://example.com:8443/hello?x=1" {
+		t.Errorf("plain HTTP = %d %q, want 308 to https://example.com:8443/hello?x=1", code, loc)
+	}
+
+	// A request made over TLS is served
+	r = httptest.NewRequest(http.MethodGet, "https://example.com/hello", nil)
+	r.TLS = &tls.ConnectionState{}
+	if code, _ := redirectTo(t, cfg, r); code != http.StatusOK {
+		t.Errorf("TLS request = %d, want 200", code)
+	}
+
+	// Exempt paths and subtrees are served over plain HTTP
+	cfg.ExemptPaths = []string{"/healthz", "/metrics/"}
+	for _, path := range []string{"/healthz", "/metrics/go"} {
+		if code, _ := redirectTo(t, cfg, httptest.NewRequest(http.MethodGet, path, nil)); code != http.StatusOK {
+			t.Errorf("exempt %s = %d, want 200", path, code)
+		}
+	}
+}
+
+func TestHTTPSRedirectDetectsForwardedProto(t *testing.T) {
+	cfg := HTTPSRedirectConfig{Enabled: true, TrustForwardedProto: true}
+	forwarded := func(remote, proto string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/hello", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-Proto", proto)
+		return r
+	}
+
+	// A trusted proxy reporting HTTPS is believed, reporting HTTP redirected
+	if code, _ := redirectTo(t, cfg, forwarded("10.0.0.1:1234", "https")); code != http.StatusOK {
+		t.Errorf("trusted proxy over HTTPS = %d, want 200", code)
+	}
+	if code, loc := redirectTo(t, cfg, forwarded("10.0.0.1:1234", "http")); code != http.StatusPermanentRedirect || loc != "https://example.com/hello" {
+		t.Errorf("trusted proxy over HTTP = %d %q, want 308 to https://example.com/hello", code, loc)
+	}
+
+	// Clients can't skip the redirect by sending the header themselves
+	if code, _ := redirectTo(t, cfg, forwarded("192.0.2.1:1234", "https")); code != http.StatusPermanentRedirect {
+		t.Errorf("untrusted peer claiming HTTPS = %d, want 308", code)
+	}
+}
+
+func TestHTTPSRedirectKeepsIPv6Hosts(t *testing.T) {
+	for _, tc := range []struct {
+		host, port, want string
+	}{
+		{"[::1]:8080", "443", "https://[::1]/hello"},
+		{"[::1]:8080", "8443", "https://[::1]:8443/hello"},
+		{"[::1]", "8443", "https://[::1]:8443/hello"},
+		{"[::1]", "443", "https://[::1]/hello"},
+		{"[::1]:8080", "", "https://[::1]:8080/hello"},
+		{"example.com:8080", "443", "https://example.com/hello"},
+		{"example.com", "8443", "https://example.com:8443/hello"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/hello", nil)
+		r.Host = tc.host
+		cfg := HTTPSRedirectConfig{Enabled: true, Port: tc.port}
+		if code, loc := redirectTo(t, cfg, r); code != http.StatusPermanentRedirect || loc != tc.want {
+			t.Errorf("host %q port %q = %d %q, want 308 to %s", tc.host, tc.port, code, loc, tc.want)
+		}
+	}
+}
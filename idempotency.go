@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultIdempotencyMaxKeys caps how many keys are remembered by default
+	defaultIdempotencyMaxKeys = 10000
+	// defaultIdempotencyMaxBodyBytes caps the request body hashed and the
+	// response body kept for each key by default
+	defaultIdempotencyMaxBodyBytes = 1 << 20
+	// maxIdempotencyKeyLength is the longest Idempotency-Key accepted
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyConfig configures replaying responses to retried requests
+// carrying the same Idempotency-Key, off by default
+type IdempotencyConfig struct {
+	// TTL is how long a response is replayed for its key, zero disables the
+	// middleware
+	TTL time.Duration `yaml:"ttl"`
+	// MaxKeys caps the keys remembered, requests with new keys beyond it are
+	// served without protection
+	MaxKeys int `yaml:"max_keys"`
+	// MaxBodyBytes is the largest request body accepted with a key and the
+	// largest response body kept, bigger responses aren't replayed
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+}
+
+// loadEnv overrides the idempotency config with any values set in the environment
+func (c *IdempotencyConfig) loadEnv() error {
+	var err error
+	if c.TTL, err = envDuration("IDEMPOTENCY_TTL", c.TTL); err != nil {
+		return err
+	}
+	if c.MaxKeys, err = envInt("IDEMPOTENCY_MAX_KEYS", c.MaxKeys); err != nil {
+		return err
+	}
+	if c.MaxBodyBytes, err = envInt64("IDEMPOTENCY_MAX_BODY_BYTES", c.MaxBodyBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a negative TTL or size cap
+func (c *IdempotencyConfig) Validate() error {
+	return errors.Join(
+		checkNotNegative("idempotency.ttl", c.TTL),
+		checkNotNegative("idempotency.max_keys", c.MaxKeys),
+		checkNotNegative("idempotency.max_body_bytes", c.MaxBodyBytes),
+	)
+}
+
+// idempotentCall is the first request made with a key. Requests repeating
+// the key with the same body wait for done and then replay resp.
+type idempotentCall struct {
+	bodyHash [sha256.Size]byte
+	done     chan struct{}
+	resp     *cachedResponse
+	expires  time.Time
+}
+
+// IdempotencyStore remembers the responses to unsafe requests by their
+// Idempotency-Key, so a client retrying a POST, PUT or PATCH gets the
+// original response instead of repeating its side effects
+type IdempotencyStore struct {
+	cfg     IdempotencyConfig
+	proxies TrustedProxies
+	log     *zap.Logger
+	mu      sync.Mutex
+	calls   map[string]*idempotentCall
+}
+
+// NewIdempotencyStore creates an IdempotencyStore and evicts expired keys
+// while the app runs
+func NewIdempotencyStore(lc fx.Lifecycle, cfg IdempotencyConfig, proxies TrustedProxies, log *zap.Logger) *IdempotencyStore {
+	if cfg.MaxKeys <= 0 {
+		cfg.MaxKeys = defaultIdempotencyMaxKeys
+	}
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultIdempotencyMaxBodyBytes
+	}
+	s := &IdempotencyStore{cfg: cfg, proxies: proxies, log: log, calls: make(map[string]*idempotentCall)}
+
+	// Nothing to evict when the middleware is disabled
+	if cfg.TTL <= 0 {
+		return s
+	}
+
+	// Run the eviction loop between start and stop
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				s.evictLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+	return s
+}
+
+// evictLoop periodically drops the keys whose responses have expired
+func (s *IdempotencyStore) evictLoop(ctx context.Context) {
+	ticker := time.NewTicker(min(s.cfg.TTL/2, time.Minute))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := s.evict(now); n > 0 {
+				s.log.Debug("Evicted expired idempotency keys", zap.Int("count", n))
+			}
+		}
+	}
+}
+
+// evict removes the settled calls expired before now and returns how many were dropped
+func (s *IdempotencyStore) evict(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, call := range s.calls {
+		if call.resp != nil && now.After(call.expires) {
+			delete(s.calls, key)
+			n++
+		}
+	}
+	return n
+}
+
+// claim returns the call already made with key, or registers a new one made
+// with a body hashing to bodyHash for the caller to run and reports true. A
+// nil call with false means the store is full and the request goes
+// unprotected.
+func (s *IdempotencyStore) claim(key string, bodyHash [sha256.Size]byte, now time.Time) (*idempotentCall, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if call, ok := s.calls[key]; ok && (call.resp == nil || now.Before(call.expires)) {
+		return call, false
+	}
+	if len(s.calls) >= s.cfg.MaxKeys {
+		return nil, false
+	}
+	call := &idempotentCall{bodyHash: bodyHash, done: make(chan struct{})}
+	s.calls[key] = call
+	return call, true
+}
+
+// settle records the outcome of a claimed call and wakes the requests
+// waiting on it. A nil resp forgets the key so the next retry runs again.
+func (s *IdempotencyStore) settle(key string, call *idempotentCall, resp *cachedResponse) {
+	s.mu.Lock()
+	if resp != nil {
+		call.resp = resp
+		call.expires = resp.expires
+	} else {
+		delete(s.calls, key)
+	}
+	s.mu.Unlock()
+	close(call.done)
+}
+
+// idempotent reports whether r is an unsafe request the middleware covers
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return r.Header.Get("Idempotency-Key") != ""
+	}
+	return false
+}
+
+// Middleware replays the first response to a POST, PUT or PATCH for every
+// later request with the same Idempotency-Key, method, path and body,
+// marking replays with "Idempotent-Replayed: true". Reusing a key with a
+// different body is answered with a 422. Keys are scoped to the request's
+// user, or to the client IP for anonymous requests. A request repeating a
+// key still in flight waits for the first one. Only successful responses
+// are remembered, so a retry after an error, or after a response too large
+// to keep, runs the handler again.
+func (s *IdempotencyStore) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		if s.cfg.TTL <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !idempotent(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.Header.Get("Idempotency-Key")
+			if len(key) > maxIdempotencyKeyLength {
+				RespondError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Idempotency-Key too long")
+				return
+			}
+
+			// Read the body to compare it with the first request's, bounded
+			// since it's held in memory until the handler is done with it
+			body, err := io.ReadAll(io.LimitReader(r.Body, s.cfg.MaxBodyBytes+1))
+			if err != nil {
+				s.log.Warn("Failed to read request body", zap.Error(err))
+				RespondError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Failed to read request body")
+				return
+			}
+			if int64(len(body)) > s.cfg.MaxBodyBytes {
+				RespondError(w, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge, "Request body too large for an Idempotency-Key")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			bodyHash := sha256.Sum256(body)
+
+			// Scope the key so different users, anonymous clients and routes
+			// never share responses
+			owner := "ip:" + clientAddr(r, s.proxies)
+			if user, ok := UserFromContext(r.Context()); ok {
+				owner = "user:" + user.ID
+			}
+			scope := owner + " " + r.Method + " " + r.URL.Path + " " + key
+
+			// Wait out a request already running with the key, then replay
+			// its response or, if it wasn't kept, try to run again
+			for {
+				call, first := s.claim(scope, bodyHash, time.Now())
+				if call == nil {
+					s.log.Warn("Idempotency key store full", zap.Int("max_keys", s.cfg.MaxKeys))
+					next.ServeHTTP(w, r)
+					return
+				}
+				if call.bodyHash != bodyHash {
+					RespondError(w, http.StatusUnprocessableEntity, ErrorCodeIdempotencyKeyReused,
+						"Idempotency-Key was already used with a different request body")
+					return
+				}
+				if first {
+					s.run(w, r, next, scope, call)
+					return
+				}
+				select {
+				case <-call.done:
+				case <-r.Context().Done():
+					return
+				}
+				if call.resp != nil {
+					w.Header().Set("Idempotent-Replayed", "true")
+					call.resp.writeTo(w)
+					return
+				}
+			}
+		})
+	}
+}
+
+// run serves the first request with a key, keeping a successful response
+// for retries
+func (s *IdempotencyStore) run(w http.ResponseWriter, r *http.Request, next http.Handler, scope string, call *idempotentCall) {
+	// Always release the waiting requests, even if the handler panics
+	var resp *cachedResponse
+	defer func() { s.settle(scope, call, resp) }()
+
+	before := w.Header().Clone()
+	rec := &cacheRecorder{ResponseWriter: w, body: &capBuffer{max: s.cfg.MaxBodyBytes}}
+	next.ServeHTTP(rec, r)
+	if rec.Status() >= http.StatusBadRequest || rec.tooLarge() {
+		return
+	}
+	now := time.Now()
+	resp = &cachedResponse{
+		key:     scope,
+		status:  rec.Status(),
+		header:  changedHeaders(before, w.Header()),
+		body:    bytes.Clone(rec.body.Bytes()),
+		stored:  now,
+		expires: now.Add(s.cfg.TTL),
+	}
+}
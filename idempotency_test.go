@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+// newTestIdempotency returns the idempotency middleware around h, keeping
+// responses for a minute
+func newTestIdempotency(t *testing.T, h http.Handler) http.Handler {
+	t.Helper()
+	cfg := defaultAppConfig().Idempotency
+	cfg.TTL = time.Minute
+	s := NewIdempotencyStore(fxtest.NewLifecycle(t), cfg, nil, zap.NewNop())
+	return s.Middleware()(h)
+}
+
+// idempotentPost sends a POST with the key and body from the client address
+func idempotentPost(h http.Handler, key, body, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// countingHandler answers POSTs with their body, counting how often it ran
+func countingHandler(calls *atomic.Int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body := new(strings.Builder)
+		_, _ = io.Copy(body, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created " + body.String()))
+	})
+}
+
+func TestIdempotencyReplaysRepeatedKey(t *testing.T) {
+	var calls atomic.Int64
+	h := newTestIdempotency(t, countingHandler(&calls))
+
+	first := idempotentPost(h, "k1", "alice", "192.0.2.1:1234")
+	second := idempotentPost(h, "k1", "alice", "192.0.2.1:1234")
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls.Load())
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Fatalf("replay = %d %q, want %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatal("only the replay should be marked Idempotent-Replayed")
+	}
+
+	// A new key runs the handler again
+	idempotentPost(h, "k2", "alice", "192.0.2.1:1234")
+	if calls.Load() != 2 {
+		t.Fatalf("handler ran %d times, want 2", calls.Load())
+	}
+}
+
+func TestIdempotencyRejectsKeyReusedWithDifferentBody(t *testing.T) {
+	var calls atomic.Int64
+	h := newTestIdempotency(t, countingHandler(&calls))
+
+	idempotentPost(h, "k1", "alice", "192.0.2.1:1234")
+	rec := idempotentPost(h, "k1", "mallory", "192.0.2.1:1234")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", rec.Code)
+	}
+	if got := decodeError(t, rec); got.Code != ErrorCodeIdempotencyKeyReused {
+		t.Fatalf("code = %q, want %q", got.Code, ErrorCodeIdempotencyKeyReused)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls.Load())
+	}
+}
+
+func TestIdempotencyScopesAnonymousKeysByClient(t *testing.T) {
+	var calls atomic.Int64
+	h := newTestIdempotency(t, countingHandler(&calls))
+
+	idempotentPost(h, "k1", "alice", "192.0.2.1:1234")
+	rec := idempotentPost(h, "k1", "alice", "192.0.2.2:1234")
+	if calls.Load() != 2 || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatal("another client's request with the same key was answered with a replay")
+	}
+}
+
+func TestIdempotencyDoesNotKeepErrors(t *testing.T) {
+	var calls atomic.Int64
+	h := newTestIdempotency(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first attempt only
+		if calls.Add(1) == 1 {
+			RespondError(w, http.StatusUnprocessableEntity, ErrorCodeValidationFailed, "Invalid")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if rec := idempotentPost(h, "k1", "alice", "192.0.2.1:1234"); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("first status = %d, want 422", rec.Code)
+	}
+	if rec := idempotentPost(h, "k1", "alice", "192.0.2.1:1234"); rec.Code != http.StatusCreated {
+		t.Fatalf("retry status = %d, want 201 from running the handler again", rec.Code)
+	}
+}
+
+func TestIdempotencySerializesConcurrentDuplicates(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	h := newTestIdempotency(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		_, _ = w.Write([]byte("done"))
+	}))
+
+	// Start the duplicates together and let the first finish once they all wait
+	const n = 5
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recs[i] = idempotentPost(h, "k1", "alice", "192.0.2.1:1234")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls.Load())
+	}
+	replayed := 0
+	for _, rec := range recs {
+		if rec.Code != http.StatusOK || rec.Body.String() != "done" {
+			t.Fatalf("got %d %q, want 200 \"done\"", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Idempotent-Replayed") == "true" {
+			replayed++
+		}
+	}
+	if replayed != n-1 {
+		t.Fatalf("%d replays, want %d", replayed, n-1)
+	}
+}
+
+func TestIdempotencyOffByDefault(t *testing.T) {
+	var calls atomic.Int64
+	s := NewIdempotencyStore(fxtest.NewLifecycle(t), defaultAppConfig().Idempotency, nil, zap.NewNop())
+	h := s.Middleware()(countingHandler(&calls))
+
+	idempotentPost(h, "k1", "alice", "192.0.2.1:1234")
+	idempotentPost(h, "k1", "alice", "192.0.2.1:1234")
+	if calls.Load() != 2 {
+		t.Fatalf("handler ran %d times, want 2", calls.Load())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// drainLogInterval is how often the in-flight count is logged during shutdown
+	drainLogInterval = time.Second
+	// idlePollInterval is how often the in-flight count is checked after a forced close
+	idlePollInterval = 50 * time.Millisecond
+)
+
+// InFlight counts the requests currently being served, and those served
+// since the app started
+type InFlight struct {
+	n     atomic.Int64
+	total atomic.Int64
+}
+
+// NewInFlight creates an InFlight counter starting at zero
+func NewInFlight() *InFlight {
+	return &InFlight{}
+}
+
+// Count returns the number of requests currently being served
+func (f *InFlight) Count() int64 {
+	return f.n.Load()
+}
+
+// Total returns the number of requests served or being served so far
+func (f *InFlight) Total() int64 {
+	return f.total.Load()
+}
+
+// Middleware returns a Middleware counting requests while they are served
+func (f *InFlight) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f.total.Add(1)
+			f.n.Add(1)
+			defer f.n.Add(-1)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// waitIdle waits up to timeout, or until ctx is done, for the requests still
+// being served to return, logging those that outlive it
+func (f *InFlight) waitIdle(ctx context.Context, timeout time.Duration, log *zap.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for f.Count() > 0 {
+		select {
+		case <-ctx.Done():
+			log.Warn("Requests still running after force-closing connections",
+				zap.Duration("force_close_timeout", timeout),
+				zap.Int64("in_flight", f.Count()))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// connCounter counts the connections a server has open
+type connCounter struct {
+	n atomic.Int64
+}
+
+// track is an http.Server ConnState hook keeping the count up to date.
+// Hijacked connections leave the server's hands, so they stop counting.
+func (c *connCounter) track(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		c.n.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		c.n.Add(-1)
+	}
+}
+
+// Count returns the number of open connections
+func (c *connCounter) Count() int64 {
+	return c.n.Load()
+}
+
+// logWhileDraining logs the in-flight count periodically until ctx is done
+func (f *InFlight) logWhileDraining(ctx context.Context, log *zap.Logger) {
+	ticker := time.NewTicker(drainLogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			log.Info("Waiting for in-flight requests to drain", zap.Int64("in_flight", f.Count()))
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInFlightCountsOnlyItsOwnRequests(t *testing.T) {
+	public, admin := NewInFlight(), NewInFlight()
+
+	// While a public request is served, only the public counter sees it
+	var during, adminDuring int64
+	h := public.Middleware()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		during, adminDuring = public.Count(), admin.Count()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if during != 1 || adminDuring != 0 {
+		t.Fatalf("in flight during request: public %d, admin %d, want 1 and 0", during, adminDuring)
+	}
+	if public.Count() != 0 || public.Total() != 1 {
+		t.Fatalf("after request: count %d, total %d, want 0 and 1", public.Count(), public.Total())
+	}
+}
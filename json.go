@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ErrorCode is a machine-readable identifier for the kind of error in an
+// error response
+type ErrorCode string
+
+const (
+	ErrorCodeBadRequest           ErrorCode = "bad_request"
+	ErrorCodeUnauthorized         ErrorCode = "unauthorized"
+	ErrorCodeForbidden            ErrorCode = "forbidden"
+	ErrorCodeNotFound             ErrorCode = "not_found"
+	ErrorCodeMethodNotAllowed     ErrorCode = "method_not_allowed"
+	ErrorCodeRequestTooLarge      ErrorCode = "request_too_large"
+	ErrorCodeHeadersTooLarge      ErrorCode = "headers_too_large"
+	ErrorCodeURITooLong           ErrorCode = "uri_too_long"
+	ErrorCodeValidationFailed     ErrorCode = "validation_failed"
+	ErrorCodeIdempotencyKeyReused ErrorCode = "idempotency_key_reused"
+	ErrorCodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	ErrorCodeRateLimited          ErrorCode = "rate_limited"
+	ErrorCodeUnavailable          ErrorCode = "unavailable"
+	ErrorCodeInternal             ErrorCode = "internal"
+)
+
+// errorDetail describes an error inside the error envelope
+type errorDetail struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// errorResponse is the JSON envelope written for error responses
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+// DecodeJSON decodes a single JSON value from the request body into v
+func DecodeJSON(r *http.Request, v any) error {
+	// Reject unknown fields so typos in requests are surfaced
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("decode JSON body: %w", err)
+	}
+
+	// Anything after the first value means the body is malformed
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("decode JSON body: unexpected data after JSON value")
+	}
+	return nil
+}
+
+// WriteJSON writes v as a JSON response with the given status. The whole
+// body is built before the status is sent, so an encoding failure still
+// becomes a 500. The error returned is from writing the body, when the
+// response is already committed and can only be logged.
+func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	// Marshal before writing so encoding failures can still become a 500
+	body, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(errorResponse{Error: errorDetail{Code: ErrorCodeInternal, Message: "Internal server error"}})
+	}
+	body = append(body, '\n')
+
+	// Announce the length so a client can tell a cut-off body from a whole one
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("write JSON response: %w", err)
+	}
+	return nil
+}
+
+// RespondError writes a JSON error envelope like
+// {"error":{"code":"not_found","message":"Not found"}} with the given status
+func RespondError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	WriteJSON(w, status, errorResponse{Error: errorDetail{Code: code, Message: message}})
+}
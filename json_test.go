@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// decodeError decodes the JSON error envelope of a recorded response,
+// failing the test when the response isn't one
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) errorDetail {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	var resp errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("body %q is not a JSON error envelope: %v", rec.Body.String(), err)
+	}
+	return resp.Error
+}
+
+func TestRespondErrorWritesEnvelope(t *testing.T) {
+	rec := httptest.NewRecorder()
+	RespondError(rec, http.StatusNotFound, ErrorCodeNotFound, "Not found")
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if got := decodeError(t, rec); got != (errorDetail{Code: ErrorCodeNotFound, Message: "Not found"}) {
+		t.Fatalf("error = %+v", got)
+	}
+	if rec.Body.String() != `{"error":{"code":"not_found","message":"Not found"}}`+"\n" {
+		t.Fatalf("body = %q", rec.Body.String())
+	}
+}
+
+func TestWriteJSONTurnsEncodingFailuresIntoInternalErrors(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := WriteJSON(rec, http.StatusOK, map[string]any{"bad": make(chan int)}); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if got := decodeError(t, rec); got.Code != ErrorCodeInternal {
+		t.Fatalf("code = %q, want %q", got.Code, ErrorCodeInternal)
+	}
+}
+
+// failingWriter accepts the first few bytes of the body and then fails,
+// like a client hanging up mid-response
+type failingWriter struct {
+	header   http.Header
+	statuses []int
+	body     []byte
+	accept   int
+}
+
+func (w *failingWriter) Header() http.Header { return w.header }
+
+func (w *failingWriter) WriteHeader(status int) { w.statuses = append(w.statuses, status) }
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	n := min(len(b), w.accept-len(w.body))
+	w.body = append(w.body, b[:n]...)
+	if n < len(b) {
+		return n, errors.New("connection reset by peer")
+	}
+	return n, nil
+}
+
+func TestWriteJSONReportsFailedWrites(t *testing.T) {
+	w := &failingWriter{header: make(http.Header), accept: 5}
+	err := WriteJSON(w, http.StatusOK, map[string]string{"greeting": "Hello, Ada"})
+	if err == nil || !strings.Contains(err.Error(), "connection reset by peer") {
+		t.Fatalf("err = %v, want the write failure", err)
+	}
+
+	// The status went out once, with the length the client should expect
+	if len(w.statuses) != 1 || w.statuses[0] != http.StatusOK {
+		t.Fatalf("statuses = %v, want a single 200", w.statuses)
+	}
+	if got := w.header.Get("Content-Length"); got != "26" {
+		t.Fatalf("Content-Length = %q, want 26", got)
+	}
+}
+
+func TestMuxErrorsUseEnvelope(t *testing.T) {
+	h := newTestMux(t, defaultServerConfig(), NewStaticHandler(zap.NewNop(), StaticConfig{Dir: t.TempDir(), Prefix: "/static/"}))
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		code         ErrorCode
+	}{
+		{http.MethodGet, "/missing", http.StatusNotFound, ErrorCodeNotFound},
+		{http.MethodPost, "/static/app.css", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: status = %d, want %d", tc.method, tc.path, rec.Code, tc.status)
+			continue
+		}
+		if got := decodeError(t, rec); got.Code != tc.code {
+			t.Errorf("%s %s: code = %q, want %q", tc.method, tc.path, got.Code, tc.code)
+		}
+	}
+}
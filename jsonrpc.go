@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// jsonRPCMethodsGroup is the value group of methods served on /rpc
+const jsonRPCMethodsGroup = "jsonrpc_methods"
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+)
+
+// JSONRPCError is a JSON-RPC error object. Methods return one to choose the
+// code sent to the caller, any other error becomes an internal error.
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Error implements the error interface
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// JSONRPCFunc handles a call of a JSON-RPC method, returning the result to
+// marshal into the response
+type JSONRPCFunc func(ctx context.Context, params json.RawMessage) (any, error)
+
+// JSONRPCMethod is a method served by the JSONRPCHandler
+type JSONRPCMethod struct {
+	Name    string
+	Handler JSONRPCFunc
+}
+
+// AsJSONRPCMethod annotates a function returning a JSONRPCMethod so it is
+// served on /rpc, e.g.
+//
+//	AsJSONRPCMethod(func() JSONRPCMethod { return JSONRPCMethod{Name: "ping", Handler: ping} })
+func AsJSONRPCMethod(f any) any {
+	return fx.Annotate(f, fx.ResultTags(`group:"`+jsonRPCMethodsGroup+`"`))
+}
+
+// DecodeJSONRPCParams decodes the params of a call into v, returning an
+// invalid params error when they don't fit
+func DecodeJSONRPCParams(params json.RawMessage, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &JSONRPCError{Code: JSONRPCInvalidParams, Message: "Invalid params", Data: err.Error()}
+	}
+	return nil
+}
+
+// jsonRPCRequest is a single JSON-RPC request. ID is nil for notifications,
+// which get no response, and "null" for an explicit null ID.
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonRPCResponse is a single JSON-RPC response
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// jsonRPCHandlerParams holds the dependencies of the JSONRPCHandler
+type jsonRPCHandlerParams struct {
+	fx.In
+
+	Log     *zap.Logger
+	Config  ServerConfig
+	Methods []JSONRPCMethod `group:"jsonrpc_methods"`
+}
+
+// JSONRPCHandler serves JSON-RPC 2.0 calls, single or batched, dispatching
+// them to the methods in the "jsonrpc_methods" value group
+type JSONRPCHandler struct {
+	log          *zap.Logger
+	methods      map[string]JSONRPCFunc
+	maxBodyBytes int64
+}
+
+// NewJSONRPCHandler creates a new JSONRPCHandler instance, failing when two
+// methods share a name
+func NewJSONRPCHandler(p jsonRPCHandlerParams) (*JSONRPCHandler, error) {
+	methods := make(map[string]JSONRPCFunc, len(p.Methods))
+	for _, m := range p.Methods {
+		if _, ok := methods[m.Name]; ok {
+			return nil, fmt.Errorf("duplicate JSON-RPC method %q", m.Name)
+		}
+		methods[m.Name] = m.Handler
+	}
+	return &JSONRPCHandler{log: p.Log, methods: methods, maxBodyBytes: p.Config.withDefaults().MaxRequestBodyBytes}, nil
+}
+
+// Pattern returns the URL pattern for the JSONRPCHandler
+func (*JSONRPCHandler) Pattern() string {
+	return "/rpc"
+}
+
+// Methods restricts the JSONRPCHandler to POST requests
+func (*JSONRPCHandler) Methods() []string {
+	return []string{http.MethodPost}
+}
+
+// ContentTypes restricts the JSONRPCHandler to JSON request bodies
+func (*JSONRPCHandler) ContentTypes() []string {
+	return []string{"application/json"}
+}
+
+// ServeHTTP decodes a request or batch of requests and answers with their
+// responses. Errors are reported in the JSON-RPC envelope with a 200, and a
+// body of nothing but notifications is answered with a 204.
+func (h *JSONRPCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			RespondError(w, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge, "Request body too large")
+			return
+		}
+		h.log.Warn("Failed to read request body", zap.Error(err))
+		return
+	}
+
+	// Tell a batch from a single request by its first character
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		if resp, ok := h.handle(r.Context(), body); ok {
+			WriteJSON(w, http.StatusOK, resp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		WriteJSON(w, http.StatusOK, jsonRPCErrorResponse(nil, JSONRPCParseError, "Parse error"))
+		return
+	}
+	if len(batch) == 0 {
+		WriteJSON(w, http.StatusOK, jsonRPCErrorResponse(nil, JSONRPCInvalidRequest, "Invalid Request"))
+		return
+	}
+
+	// Answer every call in the batch except the notifications
+	responses := make([]jsonRPCResponse, 0, len(batch))
+	for _, raw := range batch {
+		if resp, ok := h.handle(r.Context(), raw); ok {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	WriteJSON(w, http.StatusOK, responses)
+}
+
+// handle runs a single request, returning its response and false for a
+// notification, which gets none
+func (h *JSONRPCHandler) handle(ctx context.Context, raw json.RawMessage) (jsonRPCResponse, bool) {
+	// Reject anything that isn't a well-formed request object
+	var req jsonRPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return jsonRPCErrorResponse(nil, JSONRPCParseError, "Parse error"), true
+		}
+		return jsonRPCErrorResponse(nil, JSONRPCInvalidRequest, "Invalid Request"), true
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" || !validJSONRPCID(req.ID) {
+		return jsonRPCErrorResponse(nil, JSONRPCInvalidRequest, "Invalid Request"), true
+	}
+	notification := req.ID == nil
+
+	// Dispatch to the method, keeping the codes of JSON-RPC errors
+	fn, ok := h.methods[req.Method]
+	if !ok {
+		return jsonRPCErrorResponse(req.ID, JSONRPCMethodNotFound, "Method not found"), !notification
+	}
+	result, err := fn(ctx, req.Params)
+	if err != nil {
+		var rpcErr *JSONRPCError
+		if !errors.As(err, &rpcErr) {
+			h.log.Warn("JSON-RPC method failed", zap.String("method", req.Method), zap.Error(err))
+			rpcErr = &JSONRPCError{Code: JSONRPCInternalError, Message: "Internal error"}
+		}
+		return jsonRPCResponse{JSONRPC: "2.0", Error: rpcErr, ID: req.ID}, !notification
+	}
+
+	// Marshal the result here, so a nil result is still sent as null
+	body, err := json.Marshal(result)
+	if err != nil {
+		h.log.Warn("Failed to marshal JSON-RPC result", zap.String("method", req.Method), zap.Error(err))
+		return jsonRPCErrorResponse(req.ID, JSONRPCInternalError, "Internal error"), !notification
+	}
+	return jsonRPCResponse{JSONRPC: "2.0", Result: body, ID: req.ID}, !notification
+}
+
+// validJSONRPCID reports whether id is absent, null, a string or a number
+func validJSONRPCID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	switch id[0] {
+	case 'n', '"', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
+
+// jsonRPCErrorResponse builds an error response, with a null ID when the
+// request's ID couldn't be read
+func jsonRPCErrorResponse(id json.RawMessage, code int, message string) jsonRPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return jsonRPCResponse{JSONRPC: "2.0", Error: &JSONRPCError{Code: code, Message: message}, ID: id}
+}
+
+// NewGreetRPCMethod creates the "greet" JSON-RPC method, greeting the name
+// given in its params
+func NewGreetRPCMethod() JSONRPCMethod {
+	return JSONRPCMethod{Name: "greet", Handler: func(_ context.Context, params json.RawMessage) (any, error) {
+		var req helloRequest
+		if err := DecodeJSONRPCParams(params, &req); err != nil {
+			return nil, err
+		}
+		if req.Name == "" {
+			return nil, &JSONRPCError{Code: JSONRPCInvalidParams, Message: "Invalid params", Data: "name is required"}
+		}
+		return helloResponse{Greeting: "Hello, " + req.Name}, nil
+	}}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// callRPC posts body to a JSONRPCHandler serving the greet method
+func callRPC(t *testing.T, body string) (int, string) {
+	t.Helper()
+	h, err := NewJSONRPCHandler(jsonRPCHandlerParams{
+		Log:     zap.NewNop(),
+		Config:  defaultServerConfig(),
+		Methods: []JSONRPCMethod{NewGreetRPCMethod()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code, strings.TrimSpace(rec.Body.String())
+}
+
+func TestJSONRPCCalls(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body string
+		want string
+	}{
+		"valid call": {
+			`{"jsonrpc":"2.0","method":"greet","params":{"name":"Ada"},"id":1}`,
+			`{"jsonrpc":"2.0","result":{"greeting":"Hello, Ada"},"id":1}`,
+		},
+		"unknown method": {
+			`{"jsonrpc":"2.0","method":"shout","id":"a"}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":"a"}`,
+		},
+		"invalid params": {
+			`{"jsonrpc":"2.0","method":"greet","params":{},"id":2}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":"name is required"},"id":2}`,
+		},
+		"wrong version": {
+			`{"jsonrpc":"1.0","method":"greet","id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+		"malformed body": {
+			`{"jsonrpc":`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+		},
+		"empty batch": {
+			`[]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Errors travel in the envelope, always with a 200
+			if status, body := callRPC(t, tc.body); status != http.StatusOK || body != tc.want {
+				t.Fatalf("got %d %s, want 200 %s", status, body, tc.want)
+			}
+		})
+	}
+}
+
+func TestJSONRPCBatch(t *testing.T) {
+	// Each call is answered in order, except the notification
+	status, body := callRPC(t, `[
+		{"jsonrpc":"2.0","method":"greet","params":{"name":"Ada"},"id":1},
+		{"jsonrpc":"2.0","method":"greet","params":{"name":"Grace"}},
+		{"jsonrpc":"2.0","method":"shout","id":2},
+		42
+	]`)
+	want := `[{"jsonrpc":"2.0","result":{"greeting":"Hello, Ada"},"id":1},` +
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":2},` +
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}]`
+	if status != http.StatusOK || body != want {
+		t.Fatalf("got %d %s, want 200 %s", status, body, want)
+	}
+
+	// A batch of nothing but notifications gets no body at all
+	if status, body := callRPC(t, `[{"jsonrpc":"2.0","method":"greet","params":{"name":"Ada"}}]`); status != http.StatusNoContent || body != "" {
+		t.Fatalf("notifications got %d %q, want an empty 204", status, body)
+	}
+}
+
+func TestJSONRPCRejectsDuplicateMethods(t *testing.T) {
+	_, err := NewJSONRPCHandler(jsonRPCHandlerParams{
+		Log:     zap.NewNop(),
+		Methods: []JSONRPCMethod{NewGreetRPCMethod(), NewGreetRPCMethod()},
+	})
+	if err == nil || !strings.Contains(err.Error(), `duplicate JSON-RPC method "greet"`) {
+		t.Fatalf("got %v, want the duplicate method named", err)
+	}
+}
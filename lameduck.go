@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// LameDuckModule marks the app as not ready and waits out a grace period
+// when it begins stopping, before any server is shut down.
+//
+// fx.App.Run turns SIGINT and SIGTERM into a Stop, which runs OnStop hooks in
+// reverse registration order. The hook depends on the servers so it is
+// registered after theirs and runs first, giving load balancers time to
+// notice the failing /readyz and stop routing new traffic here.
+var LameDuckModule = fx.Module("lameduck",
+	fx.Invoke(registerLameDuck),
+)
+
+// lameDuckParams holds the dependencies of the lame duck hook
+type lameDuckParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Config    ServerConfig
+	Readiness *ReadinessState
+	Log       *zap.Logger
+
+	// The servers are only requested to order their hooks before ours. The
+	// admin server comes first so it stops after the public server, and
+	// stays reachable while it drains.
+	AdminServer *http.Server `name:"admin" optional:"true"`
+	Server      *http.Server
+}
+
+// registerLameDuck appends the OnStop hook implementing the lame duck period
+func registerLameDuck(p lameDuckParams) {
+	cfg, readiness, log := p.Config, p.Readiness, p.Log
+	p.Lifecycle.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			// Stop advertising readiness before anything is torn down
+			readiness.SetReady(false)
+			if cfg.LameDuckPeriod <= 0 {
+				return nil
+			}
+
+			// Keep serving in-flight and late-routed requests during the grace period
+			log.Info("Entering lame duck mode", zap.Duration("period", cfg.LameDuckPeriod))
+			timer := time.NewTimer(cfg.LameDuckPeriod)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+}
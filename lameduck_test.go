@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLameDuckFlipsReadinessBeforeShutdown(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Server.LameDuckPeriod = 500 * time.Millisecond
+	app, info := newTestApp(t, cfg)
+	app.RequireStart()
+	client := NewTestClient(info)
+
+	readyz := func() int {
+		resp, err := client.Get(info.BaseURL() + "/readyz")
+		if err != nil {
+			t.Fatalf("GET /readyz: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := readyz(); got != http.StatusOK {
+		t.Fatalf("ready before stop: %d, want 200", got)
+	}
+
+	// Once stopping, the server still answers but reports not ready
+	stopped := make(chan error, 1)
+	go func() { stopped <- app.Stop(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+	if got := readyz(); got != http.StatusServiceUnavailable {
+		t.Fatalf("ready during lame duck period: %d, want 503", got)
+	}
+	select {
+	case err := <-stopped:
+		t.Fatalf("stopped before the lame duck period passed: %v", err)
+	default:
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+}
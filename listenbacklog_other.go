@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// setListenBacklog reports that the backlog can't be changed on this platform
+func setListenBacklog(ln net.Listener, backlog int) error {
+	return errors.New("setting the listen backlog is not supported on this platform")
+}
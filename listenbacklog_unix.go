@@ -0,0 +1,30 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// setListenBacklog calls listen(2) again on the bound socket with backlog,
+// which these platforms accept to resize the accept queue. The kernel still
+// caps it, at net.core.somaxconn on Linux and kern.ipc.somaxconn on BSDs.
+func setListenBacklog(ln net.Listener, backlog int) error {
+	sc, ok := ln.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("listener %T has no socket to set the backlog on", ln)
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	if err := raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
+}
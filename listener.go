@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/net/netutil"
+)
+
+// Listeners are the listeners of a server. They are bound when the
+// application starts rather than when it is built, so a bind that is
+// retried waits within the start timeout and can be cancelled.
+type Listeners struct {
+	listeners []net.Listener
+}
+
+// List returns the bound listeners, primary first. It is empty until the
+// application has started.
+func (l *Listeners) List() []net.Listener {
+	return l.listeners
+}
+
+// NewListener binds the configured TCP address or Unix socket on start,
+// followed by a TCP listener for each of the ExtraAddrs. TCP listeners
+// optionally set SO_REUSEPORT so a replacement process can bind the same
+// port during a graceful restart, and can have their accept backlog and
+// the keep-alive period of their connections tuned. With MaxConnections
+// set, connections beyond the cap wait in the accept queue until one
+// closes, counted per listener. Every listener is closed again on stop,
+// including when a later bind fails the start.
+func NewListener(lc fx.Lifecycle, cfg ServerConfig, log *zap.Logger) (*Listeners, error) {
+	// Fall back to the defaults for anything the config leaves unset
+	cfg = cfg.withDefaults()
+	l := &Listeners{}
+	switch cfg.Network {
+	case "tcp":
+		l.appendTCP(lc, cfg, cfg.Addr, log)
+	case "unix":
+		if cfg.SocketPath == "" {
+			return nil, errors.New("a socket path is required for the unix listener network")
+		}
+		l.appendUnix(lc, cfg, log)
+	default:
+		return nil, fmt.Errorf("unsupported listener network %q, expected \"tcp\" or \"unix\"", cfg.Network)
+	}
+
+	// Bind the additional addresses, which always listen on TCP
+	for _, addr := range cfg.ExtraAddrs {
+		l.appendTCP(lc, cfg, addr, log)
+	}
+	return l, nil
+}
+
+// appendTCP registers the hooks binding a single TCP address according to
+// cfg on start and closing it again on stop
+func (l *Listeners) appendTCP(lc fx.Lifecycle, cfg ServerConfig, addr string, log *zap.Logger) {
+	// Apply SO_REUSEPORT to the socket before it is bound when enabled, and
+	// the keep-alive period to every connection accepted
+	lcfg := net.ListenConfig{KeepAlive: cfg.TCPKeepAlive}
+	if cfg.ReusePort {
+		lcfg.Control = reusePortControl
+	}
+
+	var ln net.Listener
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// Bind the address, retrying while it is still in use when configured
+			var err error
+			ln, err = listenWithRetry(ctx, func() (net.Listener, error) {
+				return lcfg.Listen(ctx, "tcp", addr)
+			}, cfg.ListenRetry, log)
+			if err != nil {
+				return listenError(addr, err)
+			}
+			log.Debug("Bound listener", zap.Stringer("addr", ln.Addr()), zap.Bool("reuse_port", cfg.ReusePort))
+
+			// Resize the accept queue, which Go always creates at the system maximum
+			if cfg.ListenBacklog > 0 {
+				if err := setListenBacklog(ln, cfg.ListenBacklog); err != nil {
+					ln.Close()
+					return fmt.Errorf("failed to set listen backlog on %s: %w", addr, err)
+				}
+			}
+			l.listeners = append(l.listeners, limitListener(ln, cfg.MaxConnections, log))
+			return nil
+		},
+		// Close the listener on stop in case the server never started serving it
+		OnStop: func(context.Context) error {
+			if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			return nil
+		},
+	})
+}
+
+// listenError wraps a failure to bind addr, explaining the common case of
+// another process already holding the port. Platforms whose errors don't
+// match EADDRINUSE get the plain wrapped error.
+func listenError(addr string, err error) error {
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	_, port, _ := net.SplitHostPort(addr)
+	return fmt.Errorf("failed to listen on %s, the address is already in use by another process "+
+		"(find it with `lsof -iTCP:%s -sTCP:LISTEN` or `ss -ltnp 'sport = :%s'`, or set a different address): %w",
+		addr, port, port, err)
+}
+
+// limitListener caps the connections accepted from ln when max is positive
+func limitListener(ln net.Listener, max int, log *zap.Logger) net.Listener {
+	if max <= 0 {
+		return ln
+	}
+	log.Debug("Limiting concurrent connections", zap.Stringer("addr", ln.Addr()), zap.Int("max_connections", max))
+	return netutil.LimitListener(ln, max)
+}
+
+// listenWithRetry calls listen up to MaxAttempts times while it fails with
+// the address in use, doubling the wait between attempts up to MaxBackoff.
+// Any other error, or ctx ending during a wait, fails it straight away.
+func listenWithRetry(ctx context.Context, listen func() (net.Listener, error), retry ListenRetryConfig, log *zap.Logger) (net.Listener, error) {
+	backoff := retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		ln, err := listen()
+		if err == nil || !errors.Is(err, syscall.EADDRINUSE) || attempt >= retry.MaxAttempts {
+			return ln, err
+		}
+		log.Warn("Failed to bind listener, retrying",
+			zap.Error(err),
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", retry.MaxAttempts),
+			zap.Duration("backoff", backoff),
+		)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("gave up retrying after %d attempts: %w", attempt, errors.Join(err, ctx.Err()))
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, retry.MaxBackoff)
+	}
+}
+
+// appendUnix registers the hooks binding the Unix domain socket on start,
+// replacing a stale socket file left behind by a previous run, and closing
+// it and removing the file again on stop
+func (l *Listeners) appendUnix(lc fx.Lifecycle, cfg ServerConfig, log *zap.Logger) {
+	path := cfg.SocketPath
+	var ln net.Listener
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			// Only remove what is actually a socket, never a regular file
+			if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+				log.Info("Removing stale socket file", zap.String("path", path))
+				if err := os.Remove(path); err != nil {
+					return fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+				}
+			}
+
+			// Bind the socket
+			var err error
+			ln, err = net.Listen("unix", path)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", path, err)
+			}
+			l.listeners = append(l.listeners, limitListener(ln, cfg.MaxConnections, log))
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			return nil
+		},
+	})
+}
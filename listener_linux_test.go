@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+// sockoptInt reads an integer socket option from the socket behind c
+func sockoptInt(t *testing.T, c syscall.Conn, level, opt int) int {
+	t.Helper()
+	raw, err := c.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		value, sockErr = unix.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+	return value
+}
+
+func TestListenerAppliesListenConfig(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	cfg := ServerConfig{
+		Addr:          "127.0.0.1:0",
+		ReusePort:     true,
+		TCPKeepAlive:  42 * time.Second,
+		ListenBacklog: 16,
+	}
+	listeners, err := NewListener(lc, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	// SO_REUSEPORT was set on the listening socket before it was bound
+	ln := listeners.List()[0]
+	if got := sockoptInt(t, ln.(*net.TCPListener), unix.SOL_SOCKET, unix.SO_REUSEPORT); got != 1 {
+		t.Errorf("SO_REUSEPORT = %d, want 1", got)
+	}
+
+	// Accepted connections use the configured keep-alive period
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := sockoptInt(t, conn.(*net.TCPConn), unix.IPPROTO_TCP, unix.TCP_KEEPIDLE); got != 42 {
+		t.Errorf("TCP_KEEPIDLE = %ds, want 42s", got)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestListenerBindsOnStart(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	listeners, err := NewListener(lc, ServerConfig{Addr: "127.0.0.1:0"}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is bound while the application is being built
+	if n := len(listeners.List()); n != 0 {
+		t.Fatalf("%d listeners before start, want 0", n)
+	}
+	lc.RequireStart()
+	if n := len(listeners.List()); n != 1 {
+		t.Fatalf("%d listeners after start, want 1", n)
+	}
+	lc.RequireStop()
+}
+
+func TestStartFailsClearlyOnPortInUse(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	// The startup error names the conflicting address and explains it
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = busy.Addr().String()
+	app, _ := newTestApp(t, cfg)
+	err = app.Start(context.Background())
+	if err == nil {
+		app.RequireStop()
+		t.Fatal("start succeeded with the port in use")
+	}
+	for _, want := range []string{"failed to listen on " + cfg.Server.Addr, "already in use"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't contain %q", err, want)
+		}
+	}
+}
+
+func TestListenerExplainsAddressInUse(t *testing.T) {
+	// Bind the same port twice, the second through the listener
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	addr := busy.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+
+	lc := fxtest.NewLifecycle(t)
+	if _, err := NewListener(lc, ServerConfig{Addr: addr}, zap.NewNop()); err != nil {
+		t.Fatal(err)
+	}
+	err = lc.Start(context.Background())
+	if err == nil {
+		lc.RequireStop()
+		t.Fatal("second bind of the same port succeeded")
+	}
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("error %v doesn't wrap EADDRINUSE", err)
+	}
+	for _, want := range []string{"already in use by another process", "lsof -iTCP:" + port, "ss -ltnp 'sport = :" + port + "'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't contain %q", err, want)
+		}
+	}
+}
+
+func TestListenErrorFallsBackToGenericMessage(t *testing.T) {
+	// Other bind failures are wrapped without the port-in-use advice
+	cause := errors.New("permission denied")
+	err := listenError("127.0.0.1:80", cause)
+	if !errors.Is(err, cause) || err.Error() != "failed to listen on 127.0.0.1:80: permission denied" {
+		t.Fatalf("got %q, want the plain wrapped error", err)
+	}
+}
+
+func TestListenerRetriesAddressInUse(t *testing.T) {
+	// Hold the port, then release it while the listener backs off
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := busy.Addr().String()
+	time.AfterFunc(150*time.Millisecond, func() { busy.Close() })
+
+	lc := fxtest.NewLifecycle(t)
+	cfg := ServerConfig{
+		Addr:        addr,
+		ListenRetry: ListenRetryConfig{MaxAttempts: 10, InitialBackoff: 50 * time.Millisecond, MaxBackoff: 100 * time.Millisecond},
+	}
+	listeners, err := NewListener(lc, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc.RequireStart()
+	if got := listeners.List()[0].Addr().String(); got != addr {
+		t.Fatalf("bound %s, want %s", got, addr)
+	}
+	lc.RequireStop()
+}
+
+func TestListenWithRetryOnlyRetriesAddressInUse(t *testing.T) {
+	retry := ListenRetryConfig{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	attempts := 0
+	_, err := listenWithRetry(context.Background(), func() (net.Listener, error) {
+		attempts++
+		return nil, errors.New("permission denied")
+	}, retry, zap.NewNop())
+	if err == nil || attempts != 1 {
+		t.Fatalf("got %v after %d attempts, want an error after 1", err, attempts)
+	}
+}
+
+func TestListenWithRetryStopsWhenContextEnds(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	// A long backoff is cut short by the start context ending
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	retry := ListenRetryConfig{MaxAttempts: 5, InitialBackoff: time.Minute, MaxBackoff: time.Minute}
+	start := time.Now()
+	_, err = listenWithRetry(ctx, func() (net.Listener, error) {
+		return net.Listen("tcp", busy.Addr().String())
+	}, retry, zap.NewNop())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the context deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("gave up after %s, want about 50ms", elapsed)
+	}
+}
+
+func TestExtraAddrsServeTheSameMux(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Server.ExtraAddrs = []string{"127.0.0.1:0"}
+	var listeners *Listeners
+	app, info := newTestApp(t, cfg, fx.Populate(&listeners))
+	app.RequireStart()
+	defer app.RequireStop()
+
+	// Both ports answer the same routes
+	lns := listeners.List()
+	if len(lns) != 2 {
+		t.Fatalf("%d listeners, want 2", len(lns))
+	}
+	client := NewTestClient(info)
+	for _, ln := range lns {
+		url := "http://" + ln.Addr().String() + "/hello"
+		if status, body := postJSON(t, client, url, `{"name":"Ada"}`); status != http.StatusOK || body != `{"greeting":"Hello, Ada"}` {
+			t.Errorf("POST %s = %d %q, want 200 greeting Ada", url, status, body)
+		}
+	}
+}
+
+func TestFailedExtraAddrReleasesBoundListeners(t *testing.T) {
+	// Pick a free port for the primary address and hold the extra one
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := free.Addr().String()
+	free.Close()
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = primary
+	cfg.Server.ExtraAddrs = []string{busy.Addr().String()}
+	app, _ := newTestApp(t, cfg)
+	if err := app.Start(context.Background()); err == nil {
+		app.RequireStop()
+		t.Fatal("start succeeded with the extra address in use")
+	}
+
+	// The primary port was bound before the failure and is free again
+	ln, err := net.Listen("tcp", primary)
+	if err != nil {
+		t.Fatalf("primary address still held after the failed start: %v", err)
+	}
+	ln.Close()
+}
+
+func TestServesOverUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fxdemo.sock")
+
+	// A socket file left behind by an earlier run is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	cfg := defaultAppConfig()
+	cfg.Server.Network = "unix"
+	cfg.Server.SocketPath = path
+	app, info := newTestApp(t, cfg)
+	app.RequireStart()
+
+	if status, body := postJSON(t, NewTestClient(info), info.BaseURL()+"/hello", `{"name":"Ada"}`); status != http.StatusOK || body != `{"greeting":"Hello, Ada"}` {
+		t.Errorf("POST /hello over the socket = %d %q, want 200 greeting Ada", status, body)
+	}
+
+	// The socket file is removed again on stop
+	app.RequireStop()
+	if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("socket file still present after stop: %v", err)
+	}
+}
+
+func TestListenerCapsConnections(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	listeners, err := NewListener(lc, ServerConfig{Addr: "127.0.0.1:0", MaxConnections: 1}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lc.RequireStart()
+	defer lc.RequireStop()
+	ln := listeners.List()[0]
+
+	// Open two connections while only one may be accepted at a time
+	for range 2 {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+	first, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	select {
+	case c := <-accepted:
+		c.Close()
+		t.Fatal("accepted a second connection beyond the cap")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing the first frees the slot for the waiting one
+	first.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("second connection not accepted after the first closed")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogConfig holds the configuration for the application logger
+type LogConfig struct {
+	// Level is the minimum enabled log level, e.g. "debug" or "info"
+	Level string `yaml:"level"`
+	// Encoding is either "json" or "console"
+	Encoding string `yaml:"encoding"`
+	// OutputPaths lists the files or URLs logs are written to
+	OutputPaths []string `yaml:"output_paths"`
+}
+
+// loadEnv overrides the logger config with any values set in the environment
+func (c *LogConfig) loadEnv() {
+	c.Level = envString("LOG_LEVEL", c.Level)
+	c.Encoding = envString("LOG_ENCODING", c.Encoding)
+	c.OutputPaths = envList("LOG_OUTPUT_PATHS", c.OutputPaths)
+}
+
+// Validate reports an unknown log level or encoding
+func (c *LogConfig) Validate() error {
+	errs := []error{checkRequired("log.level", c.Level)}
+	if c.Level != "" {
+		if _, err := zapcore.ParseLevel(c.Level); err != nil {
+			errs = append(errs, fmt.Errorf("log.level: %w", err))
+		}
+	}
+	if c.Encoding != "" {
+		errs = append(errs, checkOneOf("log.encoding", c.Encoding, "json", "console"))
+	}
+	return errors.Join(errs...)
+}
+
+// NamedLogger returns a constructor deriving a logger tagged with the given
+// handler name. Provide it under a name and hand it to the handler, e.g.
+//
+//	fx.Annotate(NamedLogger("echo"), fx.ResultTags(`name:"echo"`)),
+//	AsRoute(NewEchoHandler, fx.ParamTags(`name:"echo"`)),
+func NamedLogger(name string) func(*zap.Logger) *zap.Logger {
+	return func(log *zap.Logger) *zap.Logger {
+		return log.With(zap.String("handler", name))
+	}
+}
+
+// NewLogLevel creates the level shared by the logger and the log level route,
+// so it can be changed at runtime
+func NewLogLevel(cfg LogConfig) (zap.AtomicLevel, error) {
+	level, err := zap.ParseAtomicLevel(cfg.Level)
+	if err != nil {
+		return zap.AtomicLevel{}, fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+	return level, nil
+}
+
+// NewLogger builds the zap logger described by the config and flushes it on stop
+func NewLogger(lc fx.Lifecycle, cfg LogConfig, level zap.AtomicLevel) (*zap.Logger, error) {
+	// Start from zap's production config and apply our overrides
+	zcfg := zap.NewProductionConfig()
+	zcfg.Level = level
+	if cfg.Encoding != "" {
+		zcfg.Encoding = cfg.Encoding
+	}
+	if len(cfg.OutputPaths) > 0 {
+		zcfg.OutputPaths = cfg.OutputPaths
+	}
+	if zcfg.Encoding == "console" {
+		zcfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+
+	// Build the logger
+	log, err := zcfg.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build logger: %w", err)
+	}
+
+	// Flush buffered entries on shutdown; this hook is registered early so it runs last
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			// Syncing a terminal or pipe fails harmlessly on some platforms
+			if err := log.Sync(); err != nil && !errors.Is(err, syscall.ENOTTY) && !errors.Is(err, syscall.EINVAL) {
+				return err
+			}
+			return nil
+		},
+	})
+	return log, nil
+}
+
+// LogLevelHandler is an HTTP handler reporting and changing the log level
+type LogLevelHandler struct {
+	log   *zap.Logger
+	level zap.AtomicLevel
+}
+
+// NewLogLevelHandler creates a new LogLevelHandler instance
+func NewLogLevelHandler(log *zap.Logger, level zap.AtomicLevel) *LogLevelHandler {
+	return &LogLevelHandler{log: log, level: level}
+}
+
+// Pattern returns the URL pattern for the LogLevelHandler
+func (*LogLevelHandler) Pattern() string {
+	return "/admin/loglevel"
+}
+
+// Methods restricts the LogLevelHandler to reading and replacing the level
+func (*LogLevelHandler) Methods() []string {
+	return []string{http.MethodGet, http.MethodPut}
+}
+
+// Protected requires basic auth before the level can be read or changed
+func (*LogLevelHandler) Protected() bool {
+	return true
+}
+
+// ServeHTTP delegates to zap, which answers GET with the current level and
+// sets it from a PUT body like {"level":"debug"}
+func (h *LogLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	before := h.level.Level()
+	h.level.ServeHTTP(w, r)
+	if after := h.level.Level(); after != before {
+		h.log.Info("Changed log level", zap.Stringer("from", before), zap.Stringer("to", after))
+	}
+}
@@ -2,85 +2,319 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/go-playground/validator/v10"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // main function is the entry point of the program
 func main() {
-	// Create a new Uber FX application
-	fx.New(
+	// Load the config up front, since the fx timeouts must be known before
+	// the application is built
+	cfg, err := NewAppConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Create and run a new Uber FX application with the loaded config
+	var (
+		log     *zap.Logger
+		summary *LifecycleSummary
+	)
+	app := fx.New(
+		appOptions(),
+		fx.Replace(cfg),
+		fx.StartTimeout(cfg.Server.withDefaults().StartupTimeout),
+		fx.StopTimeout(cfg.Server.withDefaults().ShutdownTimeout),
+		fx.Populate(&log, &summary),
+	)
+	os.Exit(run(app, log, summary))
+}
+
+// run starts the app, waits for a signal or shutdown request and stops it,
+// returning the exit code. Unlike fx.App.Run it explains a startup aborted
+// by the startup timeout, and summarizes the stop once every hook has run.
+func run(app *fx.App, log *zap.Logger, summary *LifecycleSummary) int {
+	startCtx, cancel := context.WithTimeout(context.Background(), app.StartTimeout())
+	defer cancel()
+	if err := app.Start(startCtx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && log != nil {
+			log.Error("Startup timed out, an OnStart hook did not return in time",
+				zap.Duration("startup_timeout", app.StartTimeout()),
+				zap.Error(err))
+		}
+		return 1
+	}
+
+	// Stop within the shutdown timeout once asked to
+	sig := <-app.Wait()
+	stopCtx, cancel := context.WithTimeout(context.Background(), app.StopTimeout())
+	defer cancel()
+	stopping := time.Now()
+	err := app.Stop(stopCtx)
+	summary.LogStop(time.Since(stopping), err)
+	if err != nil {
+		return 1
+	}
+	return sig.ExitCode
+}
+
+// appOptions returns the options making up the application, so a test
+// harness can build the same graph with fxtest.New and its own overrides
+func appOptions() fx.Option {
+	return fx.Options(
+		// Bring in the HTTP servers, middleware and built-in routes
+		HTTPModule,
+		// Run the background worker alongside the servers
+		WorkerModule,
+		// Cancel the application context before anything else stops
+		AppContextModule,
+		// Summarize the application once it has started and stopped
+		SummaryModule,
 		// Provide dependencies and configuration to the application
 		fx.Provide(
-			// HTTP server creation function
-			NewHTTPServer,
-			// Annotate the NewServeMux function with a ParamTag
-			fx.Annotate(
-				NewServeMux,
-				fx.ParamTags(`group:"routes"`),
-			),
+			// Loggers tagged with the name of the handler using them
+			fx.Annotate(NamedLogger("echo"), fx.ResultTags(`name:"echo"`)),
+			fx.Annotate(NamedLogger("hello"), fx.ResultTags(`name:"hello"`)),
 			// Register handlers as routes
-			AsRoute(NewEchoHandler),
-			AsRoute(NewHelloHandler),
-			// Register the Zap logger
-			zap.NewExample,
+			AsRoute(NewEchoHandler, fx.ParamTags(`name:"echo"`)),
+			AsRoute(NewHelloHandler, fx.ParamTags(`name:"hello"`)),
+			AsRoute(NewHelloV2Handler, fx.ParamTags(`name:"hello"`)),
+			AsRoute(NewStaticHandler),
+			AsRoute(NewWSEchoHandler),
+			AsRoute(NewPingRoute),
+			AsRoute(NewGreetRoute),
+			AsRoute(NewMeRoute),
+			// JSON-RPC methods are served on /rpc
+			AsRoute(NewJSONRPCHandler),
+			AsJSONRPCMethod(NewGreetRPCMethod),
+			// Events published to the broker are streamed on /events
+			NewEventBroker,
+			NewEventSource,
+			AsRoute(NewSSEHandler),
 		),
-		// Invoke functions that need to run during application initialization
-		fx.Invoke(func(*http.Server) {}),
 		// Configure the logger for the application using Zap
 		fx.WithLogger(func(log *zap.Logger) fxevent.Logger {
 			return &fxevent.ZapLogger{Logger: log}
 		}),
-	).Run() // Run the application
+	)
+}
+
+// NewPingRoute creates a one-off GET /ping route from a plain handler func
+func NewPingRoute() Route {
+	return NewFuncRoute("/ping", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]string{"message": "pong"})
+	}, http.MethodGet)
+}
+
+// NewMeRoute creates a GET /me route greeting the authenticated user
+func NewMeRoute() Route {
+	return NewFuncRoute("/me", func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			RespondError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Not authenticated")
+			return
+		}
+		WriteJSON(w, http.StatusOK, helloResponse{Greeting: "Hello, " + user.Name})
+	}, http.MethodGet)
+}
+
+// NewGreetRoute creates a GET /hello/{name} route reading the name from the path
+func NewGreetRoute() Route {
+	return NewFuncRoute("/hello/{name}", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, helloResponse{Greeting: "Hello, " + r.PathValue("name")})
+	}, http.MethodGet)
 }
 
 // NewHTTPServer creates a new HTTP server using provided dependencies
-func NewHTTPServer(lc fx.Lifecycle, mux *http.ServeMux, log *zap.Logger) *http.Server {
-	// Create a new HTTP server with a given ServeMux and logger
-	srv := &http.Server{Addr: ":8080", Handler: mux}
+func NewHTTPServer(lc fx.Lifecycle, shutdowner fx.Shutdowner, cfg ServerConfig, router Router, listeners *Listeners, readiness *ReadinessState, inFlight *InFlight, root *RootContext, log *zap.Logger) (*http.Server, error) {
+	// Fall back to the defaults for anything the config leaves unset
+	cfg = cfg.withDefaults()
+
+	// Fail fast if TLS is half-configured or the files are missing
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("both TLS cert and key files must be set to enable TLS")
+	}
+	for _, file := range []string{cfg.TLSCertFile, cfg.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return nil, fmt.Errorf("TLS file not accessible: %w", err)
+		}
+	}
+	tlsEnabled := cfg.TLSEnabled()
+
+	// Count the requests in flight on this server alone, around everything
+	// else, so draining waits only for its own requests
+	handler := inFlight.Middleware()(router)
+
+	// Accept cleartext HTTP/2, by prior knowledge or upgrade, when enabled
+	if cfg.EnableH2C {
+		handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: cfg.IdleTimeout})
+	}
+
+	// Create a new HTTP server with a given router and logger
+	conns := &connCounter{}
+	srv := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		// Count open connections so a forced close can report them
+		ConnState: conns.track,
+		// Derive request contexts from the root context and its shared values,
+		// marked when the server keeps serving through shutdown
+		BaseContext: func(net.Listener) context.Context {
+			if cfg.ServeWhileDraining {
+				return withServeWhileDraining(root.Context())
+			}
+			return root.Context()
+		},
+	}
+	srv.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
 
 	// Register lifecycle hooks for starting and stopping the server
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			// Start the HTTP server asynchronously
-			ln, err := net.Listen("tcp", srv.Addr)
-			if err != nil {
-				return err
+			// Record the resolved primary address of the listeners bound on
+			// start, so a ":0" port can be read back
+			addrs := make([]string, len(listeners.List()))
+			for i, ln := range listeners.List() {
+				addrs[i] = ln.Addr().String()
+			}
+			srv.Addr = addrs[0]
+
+			// Start serving every listener asynchronously with the same handler
+			log.Info("Starting HTTP server at", zap.String("addr", srv.Addr), zap.Strings("addrs", addrs), zap.Bool("tls", tlsEnabled), zap.Bool("h2c", cfg.EnableH2C))
+			readiness.SetReady(true)
+			for _, ln := range listeners.List() {
+				go func() {
+					// Serve HTTPS when TLS is configured, plain HTTP otherwise
+					var err error
+					if tlsEnabled {
+						err = srv.ServeTLS(ln, cfg.TLSCertFile, cfg.TLSKeyFile)
+					} else {
+						err = srv.Serve(ln)
+					}
+
+					// Shut the application down if a listener stops unexpectedly
+					if err != nil && !errors.Is(err, http.ErrServerClosed) {
+						log.Error("HTTP server failed", zap.Stringer("addr", ln.Addr()), zap.Error(err))
+						if err := shutdowner.Shutdown(fx.ExitCode(1)); err != nil {
+							log.Error("Failed to shut down application", zap.Error(err))
+						}
+					}
+				}()
 			}
-			log.Info("Starting HTTP server at", zap.String("addr", srv.Addr))
-			go srv.Serve(ln)
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
-			// Shutdown the HTTP server gracefully
-			return srv.Shutdown(ctx)
+			// Stop reporting ready and turn away new requests before draining connections
+			readiness.SetReady(false)
+			readiness.SetShuttingDown()
+
+			// Shutdown the HTTP server gracefully within the drain timeout, closing
+			// every listener and reporting progress while requests drain
+			drainCtx, cancel := context.WithTimeout(ctx, cfg.DrainTimeout)
+			defer cancel()
+			logCtx, stopLogging := context.WithCancel(drainCtx)
+			defer stopLogging()
+			go inFlight.logWhileDraining(logCtx, log)
+			err := srv.Shutdown(drainCtx)
+			if err == nil {
+				return nil
+			}
+
+			// Force-close the connections still open once the drain deadline
+			// passes, then give their handlers a last chance to return
+			log.Warn("Drain deadline passed, force-closing remaining connections",
+				zap.Duration("drain_timeout", cfg.DrainTimeout),
+				zap.Int64("connections", conns.Count()),
+				zap.Int64("in_flight", inFlight.Count()),
+				zap.Error(err))
+			if err := srv.Close(); err != nil {
+				return err
+			}
+			inFlight.waitIdle(ctx, cfg.ForceCloseTimeout, log)
+			return nil
 		},
 	})
 
 	// Return the created HTTP server
-	return srv
+	return srv, nil
+}
+
+// EchoConfig holds the configuration for the EchoHandler
+type EchoConfig struct {
+	// BufferAndLog reads the whole body into memory and logs it before
+	// echoing, instead of streaming it, for debugging payloads
+	BufferAndLog bool `yaml:"buffer_and_log"`
+	// MaxBodyBytes caps the size of a buffered body
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
 }
 
-// Route is an interface for HTTP handlers with a Pattern method
-type Route interface {
-	http.Handler
-	Pattern() string
+// loadEnv overrides the echo config with any values set in the environment
+func (c *EchoConfig) loadEnv() error {
+	var err error
+	if c.BufferAndLog, err = envBool("ECHO_BUFFER_AND_LOG", c.BufferAndLog); err != nil {
+		return err
+	}
+	if c.MaxBodyBytes, err = envInt64("ECHO_MAX_BODY_BYTES", c.MaxBodyBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a negative body limit
+func (c *EchoConfig) Validate() error {
+	return checkNotNegative("echo.max_body_bytes", c.MaxBodyBytes)
 }
 
 // EchoHandler is a simple HTTP handler that echoes the request body
 type EchoHandler struct {
 	log *zap.Logger
+	cfg EchoConfig
+}
+
+// helloRequest is the JSON body accepted by the HelloHandler
+type helloRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+// helloResponse is the JSON body returned by the HelloHandler
+type helloResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+// helloV2Response is the JSON body returned by the HelloV2Handler, which
+// returns the name apart from the greeting text
+type helloV2Response struct {
+	Greeting struct {
+		Text string `json:"text"`
+		Name string `json:"name"`
+	} `json:"greeting"`
 }
 
 // HelloHandler is an HTTP handler that responds with a greeting
 type HelloHandler struct {
-	log *zap.Logger
+	log          *zap.Logger
+	validate     *validator.Validate
+	maxBodyBytes int64
 }
 
 // Pattern returns the URL pattern for the EchoHandler
@@ -88,66 +322,257 @@ func (*EchoHandler) Pattern() string {
 	return "/echo"
 }
 
+// Streaming exempts the echo, which can be as long as the request body, from
+// the request timeout and the response size limit
+func (*EchoHandler) Streaming() bool {
+	return true
+}
+
+// Describe documents the EchoHandler in the OpenAPI spec
+func (*EchoHandler) Describe() RouteDescription {
+	body := map[string]any{"type": "string"}
+	return RouteDescription{
+		Methods:             []string{http.MethodPost},
+		Summary:             "Echo the request body back",
+		RequestContentType:  "application/octet-stream",
+		RequestSchema:       body,
+		ResponseContentType: "application/octet-stream",
+		ResponseSchema:      body,
+	}
+}
+
 // Pattern returns the URL pattern for the HelloHandler
 func (*HelloHandler) Pattern() string {
 	return "/hello"
 }
 
+// Version serves the HelloHandler as the first version of the API
+func (*HelloHandler) Version() string {
+	return "v1"
+}
+
+// Unversioned keeps serving the first version at "/hello", where it was
+// served before the API was versioned
+func (*HelloHandler) Unversioned() bool {
+	return true
+}
+
+// Methods restricts the HelloHandler to POST requests
+func (*HelloHandler) Methods() []string {
+	return []string{http.MethodPost}
+}
+
+// ContentTypes restricts the HelloHandler to JSON request bodies
+func (*HelloHandler) ContentTypes() []string {
+	return []string{"application/json"}
+}
+
 // NewHelloHandler creates a new HelloHandler instance
-func NewHelloHandler(log *zap.Logger) *HelloHandler {
-	return &HelloHandler{log: log}
+func NewHelloHandler(log *zap.Logger, validate *validator.Validate, cfg ServerConfig) *HelloHandler {
+	return &HelloHandler{log: log, validate: validate, maxBodyBytes: cfg.withDefaults().MaxRequestBodyBytes}
 }
 
 // NewEchoHandler creates a new EchoHandler instance
-func NewEchoHandler(log *zap.Logger) *EchoHandler {
-	return &EchoHandler{log: log}
+func NewEchoHandler(log *zap.Logger, cfg EchoConfig) *EchoHandler {
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultMaxRequestBodyBytes
+	}
+	return &EchoHandler{log: log, cfg: cfg}
+}
+
+// Describe documents the HelloHandler in the OpenAPI spec
+func (*HelloHandler) Describe() RouteDescription {
+	return RouteDescription{
+		Summary: "Greet the named person",
+		RequestSchema: map[string]any{
+			"type":       "object",
+			"required":   []string{"name"},
+			"properties": map[string]any{"name": map[string]any{"type": "string", "minLength": 1, "maxLength": 64}},
+		},
+		ResponseSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"greeting": map[string]any{"type": "string"}},
+		},
+	}
 }
 
 // ServeHTTP implements the HTTP handler for EchoHandler
 func (h *EchoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Copy the request body to the response writer
-	if _, err := io.Copy(w, r.Body); err != nil {
+	if h.cfg.BufferAndLog {
+		h.serveBuffered(w, r)
+		return
+	}
+
+	// Keep reading the body after the response starts, so HTTP/1.1 clients
+	// can stream both ways at once
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.log.Debug("Failed to enable full duplex", zap.Error(err))
+	}
+
+	// Copy the request body to the response writer, flushing each chunk as
+	// it arrives and stopping between chunks once the client goes away
+	ctx := r.Context()
+	n, err := io.Copy(newFlushWriter(w), newContextReader(ctx, r.Body))
+	if ctx.Err() != nil {
+		h.log.Debug("Echo aborted by client disconnect", zap.Int64("bytes", n), zap.Error(ctx.Err()))
+		return
+	}
+	if err != nil {
 		h.log.Warn("Failed to handle request", zap.Error(err))
 	}
 }
 
-// ServeHTTP implements the HTTP handler for HelloHandler
-func (h *HelloHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Read the request body
-	body, err := io.ReadAll(r.Body)
+// serveBuffered reads the whole body, bounded by the configured limit, logs
+// it and then echoes it back
+func (h *EchoHandler) serveBuffered(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes))
 	if err != nil {
-		h.log.Error("Failed to read request", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.log.Warn("Request body too large", zap.Int64("limit", maxBytesErr.Limit))
+			RespondError(w, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge, "Request body too large")
+			return
+		}
+		h.log.Warn("Failed to read request body", zap.Error(err))
 		return
 	}
+	h.log.Info("Echoing request body", zap.ByteString("body", body), zap.Int("bytes", len(body)))
+	if _, err := w.Write(body); err != nil {
+		h.log.Warn("Failed to write response", zap.Error(err))
+	}
+}
 
-	// Respond with a greeting containing the request body
-	if _, err := fmt.Fprintf(w, "Hello, %s\n", body); err != nil {
-		h.log.Error("Failed to write response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+// ServeHTTP implements the HTTP handler for HelloHandler
+func (h *HelloHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decode(w, r)
+	if !ok {
 		return
 	}
+
+	// Respond with a greeting for the requested name
+	h.respond(w, helloResponse{Greeting: "Hello, " + req.Name})
+}
+
+// respond writes resp, logging a write that fails once the response is
+// committed since no error response can follow it
+func (h *HelloHandler) respond(w http.ResponseWriter, resp any) {
+	if err := WriteJSON(w, http.StatusOK, resp); err != nil {
+		h.log.Warn("Failed to write response", zap.Error(err))
+	}
+}
+
+// decode reads and validates the hello request body, answering the request
+// with an error and returning false when it can't be used
+func (h *HelloHandler) decode(w http.ResponseWriter, r *http.Request) (helloRequest, bool) {
+	// Decode the JSON request body, bounded by the configured limit and
+	// abandoned once the client goes away
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, io.NopCloser(newContextReader(ctx, r.Body)), h.maxBodyBytes)
+	var req helloRequest
+	if err := DecodeJSON(r, &req); err != nil {
+		// Nobody is left to read a response once the request is cancelled
+		if ctx.Err() != nil {
+			h.log.Debug("Hello aborted by client disconnect", zap.Error(ctx.Err()))
+			return req, false
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.log.Warn("Request body too large", zap.Int64("limit", maxBytesErr.Limit))
+			RespondError(w, http.StatusRequestEntityTooLarge, ErrorCodeRequestTooLarge, "Request body too large")
+			return req, false
+		}
+		h.log.Warn("Malformed request body", zap.Error(err))
+		RespondError(w, http.StatusBadRequest, ErrorCodeBadRequest, "Malformed JSON body")
+		return req, false
+	}
+
+	// Reject well-formed bodies whose fields break the request's rules
+	if err := h.validate.Struct(req); err != nil {
+		h.log.Debug("Invalid request body", zap.Error(err))
+		RespondValidationError(w, err)
+		return req, false
+	}
+	return req, true
+}
+
+// HelloV2Handler is the second version of the HelloHandler, accepting the
+// same requests but returning a structured greeting
+type HelloV2Handler struct {
+	*HelloHandler
 }
 
-// NewServeMux creates a new HTTP ServeMux and registers routes
-func NewServeMux(routes []Route) *http.ServeMux {
-	// Create a new ServeMux
-	mux := http.NewServeMux()
+// NewHelloV2Handler creates a new HelloV2Handler instance
+func NewHelloV2Handler(log *zap.Logger, validate *validator.Validate, cfg ServerConfig) *HelloV2Handler {
+	return &HelloV2Handler{HelloHandler: NewHelloHandler(log, validate, cfg)}
+}
+
+// Version serves the HelloV2Handler as the second version of the API
+func (*HelloV2Handler) Version() string {
+	return "v2"
+}
+
+// Unversioned leaves "/hello" to the first version
+func (*HelloV2Handler) Unversioned() bool {
+	return false
+}
+
+// Describe documents the HelloV2Handler in the OpenAPI spec
+func (h *HelloV2Handler) Describe() RouteDescription {
+	desc := h.HelloHandler.Describe()
+	desc.ResponseSchema = map[string]any{
+		"type": "object",
+		"properties": map[string]any{"greeting": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"text": map[string]any{"type": "string"},
+				"name": map[string]any{"type": "string"},
+			},
+		}},
+	}
+	return desc
+}
 
-	// Register each route in the ServeMux
-	for _, route := range routes {
-		mux.Handle(route.Pattern(), route)
+// ServeHTTP implements the HTTP handler for HelloV2Handler
+func (h *HelloV2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decode(w, r)
+	if !ok {
+		return
 	}
 
-	// Return the created ServeMux
-	return mux
+	// Respond with the greeting text and the name it greets
+	var resp helloV2Response
+	resp.Greeting.Text = "Hello, " + req.Name
+	resp.Greeting.Name = req.Name
+	h.respond(w, resp)
 }
 
-// AsRoute is a utility function to annotate a function as a Route
-func AsRoute(f any) any {
-	return fx.Annotate(
-		f,
-		fx.As(new(Route)),
-		fx.ResultTags(`group:"routes"`),
+// NamedServer provides a router, listener and *http.Server tagged with
+// name, built from the ServerConfig of the same name and the routes in
+// routeGroup
+func NamedServer(name, routeGroup string) fx.Option {
+	nameTag := fmt.Sprintf(`name:"%s"`, name)
+	return fx.Provide(
+		fx.Annotate(
+			NewServeMux,
+			fx.ParamTags(fmt.Sprintf(`group:"%s"`, routeGroup), ``, ``, ``, nameTag),
+			fx.ResultTags(nameTag),
+		),
+		fx.Annotate(
+			NewListener,
+			fx.ParamTags(``, nameTag),
+			fx.ResultTags(nameTag),
+		),
+		fx.Annotate(
+			NewServerInfo,
+			fx.ParamTags(``, nameTag, nameTag),
+			fx.ResultTags(nameTag),
+		),
+		// Only the config, router, listener and in-flight counter are named,
+		// the remaining dependencies are shared
+		fx.Annotate(
+			NewHTTPServer,
+			fx.ParamTags(``, ``, nameTag, nameTag, nameTag, ``, nameTag),
+			fx.ResultTags(nameTag),
+		),
 	)
 }
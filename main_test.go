@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/net/http2"
+)
+
+// newTestMux registers routes on a ServeMux with the default server config
+// and no global middleware
+func newTestMux(t *testing.T, cfg ServerConfig, routes ...Route) http.Handler {
+	t.Helper()
+	router, err := NewServeMux(routes, nil, AuthConfig{}, func() Router { return http.NewServeMux() }, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewServeMux: %v", err)
+	}
+	return router
+}
+
+// newTestApp builds the application from the real providers with cfg, or
+// the defaults when nil, listening on random loopback ports. It returns the
+// app, not yet started, and where its public server listens once it is.
+// Further options, such as an fx.Populate, are applied after the config.
+func newTestApp(t *testing.T, cfg *AppConfig, opts ...fx.Option) (*fxtest.App, *ServerInfo) {
+	t.Helper()
+	if cfg == nil {
+		cfg = defaultAppConfig()
+		cfg.Server.Addr = "127.0.0.1:0"
+	}
+	cfg.Server.AdminAddr = "127.0.0.1:0"
+	var info *ServerInfo
+	app := fxtest.New(t,
+		appOptions(),
+		fx.Replace(cfg),
+		// Register the metrics of each app on its own registry rather than
+		// the global one, which a second app would collide with
+		fx.Decorate(func() (prometheus.Registerer, prometheus.Gatherer) {
+			reg := prometheus.NewRegistry()
+			return reg, reg
+		}),
+		// Log through the test, shown only when it fails
+		fx.Decorate(func() *zap.Logger { return zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)) }),
+		fx.Populate(&info),
+		fx.Options(opts...),
+	)
+	return app, info
+}
+
+// postJSON posts body to url as JSON and returns the status and response body
+func postJSON(t *testing.T, client *http.Client, url, body string) (int, string) {
+	t.Helper()
+	resp, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("POST %s: reading body: %v", url, err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(b))
+}
+
+func TestEchoStreamsBeforeBodyCloses(t *testing.T) {
+	// Serve the echo with the default request timeout, which must not buffer it
+	cfg := defaultServerConfig()
+	if cfg.RequestTimeout <= 0 {
+		t.Fatal("expected a default request timeout")
+	}
+	srv := httptest.NewServer(newTestMux(t, cfg, NewEchoHandler(zap.NewNop(), EchoConfig{})))
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/echo", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respc := make(chan *http.Response, 1)
+	errc := make(chan error, 1)
+	go func() {
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			errc <- err
+			return
+		}
+		respc <- resp
+	}()
+
+	// The first chunk comes back while the request body is still open
+	if _, err := pw.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	var resp *http.Response
+	select {
+	case resp = <-respc:
+	case err := <-errc:
+		t.Fatalf("request failed: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no response before the request body closed")
+	}
+	defer resp.Body.Close()
+	got := make([]byte, 4)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(resp.Body, got)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil || string(got) != "ping" {
+			t.Fatalf("read %q, %v, want \"ping\"", got, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("echoed chunk didn't arrive before the request body closed")
+	}
+}
+
+func TestHelloVersions(t *testing.T) {
+	cfg := defaultServerConfig()
+	validate := NewValidator()
+	h := newTestMux(t, cfg,
+		NewHelloHandler(zap.NewNop(), validate, cfg),
+		NewHelloV2Handler(zap.NewNop(), validate, cfg),
+	)
+
+	for path, want := range map[string]string{
+		"/v1/hello": `{"greeting":"Hello, Ada"}`,
+		"/v2/hello": `{"greeting":{"text":"Hello, Ada","name":"Ada"}}`,
+		// The first version is still served where it was before versioning
+		"/hello": `{"greeting":"Hello, Ada"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"name":"Ada"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != want {
+			t.Errorf("POST %s = %d %q, want 200 %s", path, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestAppServesEchoAndHello(t *testing.T) {
+	app, info := newTestApp(t, nil)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	// The ":0" address was resolved to the port actually bound
+	if info.Addr == nil || strings.HasSuffix(info.Addr.String(), ":0") {
+		t.Fatalf("server address %v, want the bound port", info.Addr)
+	}
+	client := NewTestClient(info)
+
+	if status, body := postJSON(t, client, info.BaseURL()+"/echo", `{"ping":true}`); status != http.StatusOK || body != `{"ping":true}` {
+		t.Errorf("POST /echo = %d %q, want 200 with the body echoed", status, body)
+	}
+	if status, body := postJSON(t, client, info.BaseURL()+"/hello", `{"name":"Ada"}`); status != http.StatusOK || body != `{"greeting":"Hello, Ada"}` {
+		t.Errorf("POST /hello = %d %q, want 200 greeting Ada", status, body)
+	}
+}
+
+func TestHTTPServerDefaultsUnsetTimeouts(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Server.ReadTimeout = 0
+	cfg.Server.ReadHeaderTimeout = 0
+	cfg.Server.WriteTimeout = 0
+	cfg.Server.IdleTimeout = 0
+	var srv *http.Server
+	newTestApp(t, cfg, fx.Populate(&srv))
+
+	for name, got := range map[string]time.Duration{
+		"read":        srv.ReadTimeout,
+		"read header": srv.ReadHeaderTimeout,
+		"write":       srv.WriteTimeout,
+		"idle":        srv.IdleTimeout,
+	} {
+		if got <= 0 {
+			t.Errorf("%s timeout %v, want a default", name, got)
+		}
+	}
+	if srv.ReadTimeout != 15*time.Second || srv.WriteTimeout != 15*time.Second || srv.IdleTimeout != 60*time.Second {
+		t.Errorf("timeouts read %v, write %v, idle %v, want 15s, 15s and 60s", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+}
+
+func TestHelloRejectsOversizedBody(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.MaxRequestBodyBytes = 16
+	h := newTestMux(t, cfg, NewHelloHandler(zap.NewNop(), NewValidator(), cfg))
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader(`{"name":"`+strings.Repeat("a", 64)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status %d, want 413", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Code != ErrorCodeRequestTooLarge {
+		t.Errorf("error code %q, want %q", e.Code, ErrorCodeRequestTooLarge)
+	}
+}
+
+// endlessReader yields data forever, calling onRead before each read
+type endlessReader struct {
+	reads  int
+	onRead func(reads int)
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	r.reads++
+	r.onRead(r.reads)
+	for i := range p {
+		p[i] = 'x'
+	}
+	return len(p), nil
+}
+
+func TestEchoStopsWhenRequestCancelled(t *testing.T) {
+	// Cancel the request partway through an endless body
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	body := &endlessReader{onRead: func(reads int) {
+		if reads == 3 {
+			cancel()
+		}
+	}}
+	req := httptest.NewRequest(http.MethodPost, "/echo", body).WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewEchoHandler(zap.NewNop(), EchoConfig{}).ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("echo kept copying after the request was cancelled")
+	}
+	if body.reads > 4 {
+		t.Errorf("read the body %d times after cancelling on the 3rd", body.reads)
+	}
+}
+
+func TestHelloAbandonsCancelledUpload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/hello", pr).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Upload part of the body, cancel, then keep the upload trickling
+	go func() {
+		pw.Write([]byte(`{"name":`))
+		cancel()
+		pw.Write([]byte(`"Ada"`))
+	}()
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cfg := defaultServerConfig()
+		NewHelloHandler(zap.NewNop(), NewValidator(), cfg).ServeHTTP(rec, req)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("hello kept reading after the request was cancelled")
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("wrote %q to a cancelled request, want nothing", rec.Body.String())
+	}
+}
+
+func TestH2CServesHTTP2AndHTTP1(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Server.EnableH2C = true
+	app, info := newTestApp(t, cfg)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	// Speak HTTP/2 over plain TCP by prior knowledge
+	h2 := &http.Client{Timeout: defaultTestClientTimeout, Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	for proto, client := range map[string]*http.Client{"HTTP/2.0": h2, "HTTP/1.1": NewTestClient(info)} {
+		resp, err := client.Post(info.BaseURL()+"/hello", "application/json", strings.NewReader(`{"name":"Ada"}`))
+		if err != nil {
+			t.Fatalf("%s POST /hello: %v", proto, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Proto != proto {
+			t.Errorf("%s POST /hello = %d over %s, want 200", proto, resp.StatusCode, resp.Proto)
+		}
+	}
+}
+
+func TestStopForceClosesHungConnections(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Server.RequestTimeout = 0
+	cfg.Server.DrainTimeout = 100 * time.Millisecond
+	cfg.Server.ForceCloseTimeout = time.Second
+
+	// The route hangs until its connection is closed under it
+	started := make(chan struct{})
+	released := make(chan struct{})
+	hang := func() Route {
+		return NewFuncRoute("/hang", func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-r.Context().Done()
+			close(released)
+		})
+	}
+	app, info := newTestApp(t, cfg, fx.Provide(AsRoute(hang)))
+	app.RequireStart()
+	failed := make(chan error, 1)
+	go func() {
+		resp, err := NewTestClient(info).Get(info.BaseURL() + "/hang")
+		if err == nil {
+			resp.Body.Close()
+		}
+		failed <- err
+	}()
+	<-started
+
+	// Stopping waits out the drain deadline, then closes the connection
+	start := time.Now()
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < cfg.Server.DrainTimeout || elapsed > 2*time.Second {
+		t.Errorf("stop took %s, want just past the %s drain timeout", elapsed, cfg.Server.DrainTimeout)
+	}
+	select {
+	case <-released:
+	default:
+		t.Fatal("hung handler still running after stop")
+	}
+	if err := <-failed; err == nil {
+		t.Fatal("hung request completed, want its connection force-closed")
+	}
+}
+
+func TestRunAbortsSlowStartup(t *testing.T) {
+	// An OnStart hook that never returns on its own
+	app := fx.New(
+		fx.NopLogger,
+		fx.StartTimeout(50*time.Millisecond),
+		fx.Invoke(func(lc fx.Lifecycle) {
+			lc.Append(fx.Hook{OnStart: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}})
+		}),
+	)
+	if err := app.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// run gives up after the startup timeout and says why
+	core, logs := observer.New(zap.ErrorLevel)
+	done := make(chan int, 1)
+	go func() { done <- run(app, zap.New(core), nil) }()
+	select {
+	case code := <-done:
+		if code != 1 {
+			t.Errorf("exit code %d, want 1", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run still starting long after the startup timeout")
+	}
+	entries := logs.FilterMessage("Startup timed out, an OnStart hook did not return in time").All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d startup timeouts, want 1", len(entries))
+	}
+	if err, _ := entries[0].ContextMap()["error"].(string); !strings.Contains(err, context.DeadlineExceeded.Error()) {
+		t.Errorf("logged error %q, want the start deadline", err)
+	}
+}
+
+func TestHelloLogsFailedResponseWrites(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	h := NewHelloHandler(zap.New(core), NewValidator(), defaultServerConfig())
+	req := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader(`{"name":"Ada"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	// The committed 200 isn't followed by a second status for the error
+	w := &failingWriter{header: make(http.Header), accept: 5}
+	h.ServeHTTP(w, req)
+	if len(w.statuses) != 1 || w.statuses[0] != http.StatusOK {
+		t.Fatalf("statuses = %v, want a single 200", w.statuses)
+	}
+	if string(w.body) != `{"gre` {
+		t.Fatalf("body = %q, want only what the writer accepted", w.body)
+	}
+	if logs.FilterMessage("Failed to write response").Len() != 1 {
+		t.Fatalf("logged %v, want the failed write", logs.All())
+	}
+}
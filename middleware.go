@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/net/http/httpguts"
+)
+
+// Middleware decorates an http.Handler with additional behavior
+type Middleware func(http.Handler) http.Handler
+
+// Priorities of the built-in middleware. Lower priorities wrap higher ones,
+// so they run first on the way in and last on the way out; custom
+// middleware can slot between two built-ins by picking a value in between.
+const (
+	PriorityTracing     = 75
+	PriorityRequestID   = 100
+	PrioritySecurity    = 150
+	PriorityUser        = 160
+	PriorityHeaders     = 175
+	PriorityAccessLog   = 200
+	PriorityRecent      = 210
+	PriorityHTTPS       = 225
+	PriorityDump        = 250
+	PriorityMetrics     = 300
+	PriorityStats       = 350
+	PriorityShutdown    = 375
+	PriorityHeaderLimit = 390
+	PriorityRateLimit   = 400
+	PriorityGzip        = 500
+	PriorityIdempotency = 550
+	PriorityRecovery    = 600
+	PriorityCORS        = 700
+	PriorityDeadline    = 900
+	PriorityDecompress  = 950
+)
+
+// OrderedMiddleware is a Middleware contributed to the "middleware" value
+// group together with its position in the chain
+type OrderedMiddleware struct {
+	// Name identifies the middleware in logs and breaks priority ties
+	Name string
+	// Priority orders the middleware, lower values wrap higher ones
+	Priority int
+	// Middleware is the decorator applied around each route
+	Middleware Middleware
+}
+
+// AsMiddleware annotates a constructor returning an OrderedMiddleware so it
+// joins the "middleware" value group
+func AsMiddleware(f any) any {
+	return fx.Annotate(
+		f,
+		fx.ResultTags(`group:"middleware"`),
+	)
+}
+
+// Chain is a list of middleware applied around each route, outermost first
+type Chain []Middleware
+
+// NewChain orders the "middleware" value group by ascending priority, then
+// name, so the chain is the same no matter the order fx supplies the group in
+func NewChain(entries []OrderedMiddleware, log *zap.Logger) Chain {
+	// Sort a copy so the group slice is left untouched
+	entries = slices.Clone(entries)
+	slices.SortFunc(entries, func(a, b OrderedMiddleware) int {
+		if c := cmp.Compare(a.Priority, b.Priority); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	// Build the chain and log the resolved order
+	chain := make(Chain, 0, len(entries))
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		chain = append(chain, e.Middleware)
+		names = append(names, e.Name)
+	}
+	log.Debug("Resolved middleware chain", zap.Strings("order", names))
+	return chain
+}
+
+// Then wraps h in the chain so the first middleware runs outermost
+func (c Chain) Then(h http.Handler) http.Handler {
+	for i := len(c) - 1; i >= 0; i-- {
+		h = c[i](h)
+	}
+	return h
+}
+
+// accessLogParams holds the dependencies of the access log middleware
+type accessLogParams struct {
+	fx.In
+
+	Config  ServerConfig
+	Proxies TrustedProxies
+	Log     *zap.Logger
+	Out     io.Writer `name:"access_log"`
+}
+
+// NewTracingMiddleware provides the OpenTelemetry server span middleware
+func NewTracingMiddleware(tp *sdktrace.TracerProvider) OrderedMiddleware {
+	return OrderedMiddleware{Name: "tracing", Priority: PriorityTracing, Middleware: TracingMiddleware(tp)}
+}
+
+// NewRequestIDMiddleware provides the request ID middleware
+func NewRequestIDMiddleware() OrderedMiddleware {
+	return OrderedMiddleware{Name: "request_id", Priority: PriorityRequestID, Middleware: RequestIDMiddleware()}
+}
+
+// NewUserMiddleware provides the middleware resolving the request's user
+func NewUserMiddleware(extract UserExtractor, log *zap.Logger) OrderedMiddleware {
+	return OrderedMiddleware{Name: "user", Priority: PriorityUser, Middleware: UserMiddleware(extract, log)}
+}
+
+// NewSecurityHeadersMiddleware provides the security headers middleware
+func NewSecurityHeadersMiddleware(cfg SecurityHeadersConfig, server ServerConfig) OrderedMiddleware {
+	return OrderedMiddleware{Name: "security_headers", Priority: PrioritySecurity, Middleware: SecurityHeadersMiddleware(cfg, server.TLSEnabled())}
+}
+
+// NewResponseHeadersMiddleware provides the custom response headers for the chain
+func NewResponseHeadersMiddleware(cfg ResponseHeadersConfig) OrderedMiddleware {
+	return OrderedMiddleware{Name: "response_headers", Priority: PriorityHeaders, Middleware: ResponseHeadersMiddleware(cfg.Headers)}
+}
+
+// NewAccessLogMiddleware provides the access log middleware
+func NewAccessLogMiddleware(p accessLogParams) OrderedMiddleware {
+	mw := AccessLogMiddleware(p.Config.withDefaults().AccessLogFormat, p.Proxies, p.Log, p.Out)
+	return OrderedMiddleware{Name: "access_log", Priority: PriorityAccessLog, Middleware: mw}
+}
+
+// NewRecentRequestsMiddleware provides the middleware recording recent requests
+func NewRecentRequestsMiddleware(rr *RecentRequests) OrderedMiddleware {
+	return OrderedMiddleware{Name: "recent_requests", Priority: PriorityRecent, Middleware: rr.Middleware()}
+}
+
+// NewHTTPSRedirectMiddleware provides the HTTPS redirect for the chain
+func NewHTTPSRedirectMiddleware(cfg HTTPSRedirectConfig, trustedProxies TrustedProxies) OrderedMiddleware {
+	return OrderedMiddleware{Name: "https_redirect", Priority: PriorityHTTPS, Middleware: HTTPSRedirectMiddleware(cfg, trustedProxies)}
+}
+
+// NewDumpMiddleware provides the request dump for the chain
+func NewDumpMiddleware(cfg DumpConfig, log *zap.Logger) OrderedMiddleware {
+	return OrderedMiddleware{Name: "dump", Priority: PriorityDump, Middleware: DumpMiddleware(cfg, log)}
+}
+
+// NewMetricsMiddleware provides the metrics middleware, skipping the metrics route itself
+func NewMetricsMiddleware(m *Metrics) OrderedMiddleware {
+	return OrderedMiddleware{Name: "metrics", Priority: PriorityMetrics, Middleware: MetricsMiddleware(m, metricsPattern)}
+}
+
+// NewStatsMiddleware provides the per-route latency summary middleware
+func NewStatsMiddleware(s *LatencyStats) OrderedMiddleware {
+	return OrderedMiddleware{Name: "stats", Priority: PriorityStats, Middleware: s.Middleware()}
+}
+
+// NewShutdownMiddleware provides the middleware rejecting requests during shutdown
+func NewShutdownMiddleware(state *ReadinessState) OrderedMiddleware {
+	return OrderedMiddleware{Name: "shutdown", Priority: PriorityShutdown, Middleware: ShutdownMiddleware(state)}
+}
+
+// NewHeaderLimitMiddleware provides the header count limit for the chain
+func NewHeaderLimitMiddleware(cfg ServerConfig) OrderedMiddleware {
+	return OrderedMiddleware{Name: "header_limit", Priority: PriorityHeaderLimit, Middleware: HeaderLimitMiddleware(cfg.withDefaults().MaxHeaderCount)}
+}
+
+// NewIdempotencyMiddleware provides the middleware replaying responses to
+// requests with a repeated Idempotency-Key
+func NewIdempotencyMiddleware(s *IdempotencyStore) OrderedMiddleware {
+	return OrderedMiddleware{Name: "idempotency", Priority: PriorityIdempotency, Middleware: s.Middleware()}
+}
+
+// NewRateLimitMiddleware provides the rate limit middleware
+func NewRateLimitMiddleware(rl *RateLimiter) OrderedMiddleware {
+	return OrderedMiddleware{Name: "rate_limit", Priority: PriorityRateLimit, Middleware: rl.Middleware()}
+}
+
+// NewGzipMiddleware provides the response compression middleware
+func NewGzipMiddleware(cfg ServerConfig) OrderedMiddleware {
+	return OrderedMiddleware{Name: "gzip", Priority: PriorityGzip, Middleware: GzipMiddleware(cfg.withDefaults().GzipMinBytes)}
+}
+
+// NewRecoveryMiddleware provides the panic recovery middleware
+func NewRecoveryMiddleware(log *zap.Logger) OrderedMiddleware {
+	return OrderedMiddleware{Name: "recovery", Priority: PriorityRecovery, Middleware: RecoveryMiddleware(log)}
+}
+
+// NewCORSMiddleware provides the CORS middleware
+func NewCORSMiddleware(cfg CORSConfig) OrderedMiddleware {
+	return OrderedMiddleware{Name: "cors", Priority: PriorityCORS, Middleware: CORSMiddleware(cfg)}
+}
+
+// NewDecompressMiddleware provides the gzip request body middleware
+func NewDecompressMiddleware(cfg ServerConfig) OrderedMiddleware {
+	mw := DecompressMiddleware(cfg.withDefaults().MaxDecompressedBodyBytes)
+	return OrderedMiddleware{Name: "decompress", Priority: PriorityDecompress, Middleware: mw}
+}
+
+// NewDeadlineMiddleware provides the caller-supplied deadline middleware
+func NewDeadlineMiddleware() OrderedMiddleware {
+	return OrderedMiddleware{Name: "deadline", Priority: PriorityDeadline, Middleware: DeadlineMiddleware()}
+}
+
+// routePatternKey is the context key holding the matched route pattern
+type routePatternKey struct{}
+
+// withRoutePattern stores the route pattern in the context of each request
+func withRoutePattern(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), routePatternKey{}, pattern)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RoutePatternFromContext returns the pattern of the route serving the request
+func RoutePatternFromContext(ctx context.Context) string {
+	pattern, _ := ctx.Value(routePatternKey{}).(string)
+	return pattern
+}
+
+// RecoveryMiddleware recovers from handler panics and responds with a 500
+func RecoveryMiddleware(log *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+
+				// Let the server abort the response as the handler intended
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				// Log the panic value together with the goroutine stack
+				log.Error("Recovered from panic in handler",
+					zap.String("request_id", RequestIDFromContext(r.Context())),
+					zap.Any("panic", rec),
+					zap.String("path", r.URL.Path),
+					zap.ByteString("stack", debug.Stack()),
+				)
+				RespondError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// responseWriter records the status code and size of a response
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// newResponseWriter wraps w so its status and size can be inspected
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+// WriteHeader records the status code before sending it
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the number of bytes written, defaulting the status to 200
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+// Status returns the recorded status code, or 200 if nothing was written
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack lets handlers such as WebSocket upgrades take over the connection
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil && rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// timeoutErrorWriter replaces the plaintext 503 of http.TimeoutHandler with
+// a JSON error. The timeout is told apart from a 503 of the route by its
+// missing Content-Type, since the route's headers are only copied over when
+// it finishes in time and routes answer errors with RespondError.
+type timeoutErrorWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+// WriteHeader writes a JSON error instead of the timeout's plaintext one
+func (w *timeoutErrorWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.replaced = true
+		RespondError(w.ResponseWriter, status, ErrorCodeUnavailable, "Request timed out")
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write discards the plaintext body once a JSON error has been written
+func (w *timeoutErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *timeoutErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// isUpgradeRequest reports whether the client asks to switch protocols,
+// which wrappers that buffer responses must let through untouched
+func isUpgradeRequest(r *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade")
+}
+
+// isEventStreamRequest reports whether the client expects Server-Sent
+// Events, a response that stays open and must be flushed as it goes
+func isEventStreamRequest(r *http.Request) bool {
+	return r.Header.Get("Accept") == "text/event-stream"
+}
+
+// LoggingMiddleware emits one structured log line per request
+func LoggingMiddleware(log *zap.Logger, proxies []net.IPNet) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Serve the request while recording the response
+			start := time.Now()
+			rw := newResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			// Log at a level matching the response status
+			status := rw.Status()
+			logLevelFor(log, status)("Handled request",
+				zap.String("request_id", RequestIDFromContext(r.Context())),
+				zap.String("client_ip", clientAddr(r, proxies)),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", status),
+				zap.Int("bytes", rw.bytes),
+				zap.Duration("duration", time.Since(start)),
+			)
+		})
+	}
+}
+
+// logLevelFor picks the log function for a response status code
+func logLevelFor(log *zap.Logger, status int) func(string, ...zap.Field) {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return log.Error
+	case status >= http.StatusBadRequest:
+		return log.Warn
+	default:
+		return log.Info
+	}
+}
+
+// TimeoutMiddleware responds with a 503 when a route exceeds the timeout.
+//
+// http.TimeoutHandler buffers the whole response until the handler returns,
+// so NewServeMux applies it per route and leaves out streaming routes such
+// as EchoHandler, which would otherwise only send their body once the copy
+// had finished and lose it entirely if the timeout fired first.
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		// Leave the route untouched when no timeout is configured
+		if timeout <= 0 {
+			return next
+		}
+
+		// The timeout writer can't be hijacked or flushed, so upgrades and
+		// event streams bypass it
+		th := http.TimeoutHandler(next, timeout, "Request timed out")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isUpgradeRequest(r) || isEventStreamRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			th.ServeHTTP(&timeoutErrorWriter{ResponseWriter: w}, r)
+		})
+	}
+}
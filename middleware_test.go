@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddlewareRespondsUnavailable(t *testing.T) {
+	// A handler outliving the timeout is answered with a 503
+	release := make(chan struct{})
+	defer close(release)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		_, _ = w.Write([]byte("too late"))
+	})
+	rec := httptest.NewRecorder()
+	TimeoutMiddleware(10*time.Millisecond)(slow).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := decodeError(t, rec); got != (errorDetail{Code: ErrorCodeUnavailable, Message: "Request timed out"}) {
+		t.Fatalf("error = %+v", got)
+	}
+}
+
+func TestTimeoutMiddlewareKeepsRouteErrors(t *testing.T) {
+	// A route answering 503 in time keeps its own error
+	busy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondError(w, http.StatusServiceUnavailable, ErrorCodeUnavailable, "Busy")
+	})
+	rec := httptest.NewRecorder()
+	TimeoutMiddleware(time.Second)(busy).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/busy", nil))
+	if got := decodeError(t, rec); got.Message != "Busy" {
+		t.Fatalf("message = %q, want \"Busy\"", got.Message)
+	}
+}
+
+func TestTimeoutMiddlewarePassesFastHandlers(t *testing.T) {
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	rec := httptest.NewRecorder()
+	TimeoutMiddleware(time.Second)(fast).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Fatalf("got %d %q, want 200 \"ok\"", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+
+	"go.uber.org/fx"
+)
+
+// HTTPModule bundles the public and admin HTTP servers, their muxes, the
+// route middleware, the zap logger and the built-in health, readiness,
+// version, metrics, stats and pprof routes.
+//
+// Consumers add their own handlers to the "routes" value group with AsRoute
+// (or to the "admin_routes" group with AsAdminRoute), e.g.
+//
+//	fx.New(HTTPModule, fx.Provide(AsRoute(NewMyHandler)))
+//
+// Additional middleware joins the "middleware" group with AsMiddleware and
+// is placed in the chain by its OrderedMiddleware.Priority.
+var HTTPModule = fx.Module("http",
+	// Provide dependencies and configuration to the module
+	fx.Provide(
+		// Application config loaded from CONFIG_FILE and the environment,
+		// split into the sections components depend on
+		NewAppConfig,
+		NewConfigSections,
+		// Admin server configuration, named to keep it apart from the public one
+		fx.Annotate(
+			NewAdminServerConfig,
+			fx.ResultTags(`name:"admin"`),
+		),
+		// Validator shared by handlers checking decoded request bodies
+		NewValidator,
+		// Readiness state shared by the server and the readiness route
+		NewReadinessState,
+		// Root of every request context, cancelled on stop
+		NewRootContext,
+		// Lifetime of the application, cancelled as soon as it stops
+		NewAppContext,
+		// In-flight request counters of the public server, also read by the
+		// health, drain and summary, and of the admin server
+		NewInFlight,
+		fx.Annotate(
+			NewInFlight,
+			fx.ResultTags(`name:"admin"`),
+		),
+		// Listener bound to the configured address
+		NewListener,
+		NewServerInfo,
+		// HTTP server creation function
+		NewHTTPServer,
+		// Router implementation the routes are registered on
+		NewRouterFactory,
+		// Annotate the NewServeMux function with a ParamTag
+		fx.Annotate(
+			NewServeMux,
+			fx.ParamTags(`group:"routes"`),
+		),
+		// Prometheus registry and request collectors
+		NewMetricsRegistry,
+		NewMetrics,
+		// Per-route latency quantiles served on /stats
+		NewLatencyStats,
+		// Responses kept for retried requests with an Idempotency-Key
+		NewIdempotencyStore,
+		// In-memory cache of GET responses for the routes opting in
+		NewResponseCache,
+		// Latest requests served on /admin/recent-requests
+		NewRecentRequests,
+		// OpenTelemetry tracer provider exporting spans over OTLP
+		NewTracerProvider,
+		// Proxies trusted to report the client address
+		NewTrustedProxies,
+		// Resolution of the user each request is made on behalf of
+		NewUserExtractor,
+		// Per-client rate limiting
+		NewRateLimiter,
+		// Reload of the log level and rate limits on SIGHUP
+		NewConfigReloader,
+		// Destination of Common Log Format access logs
+		fx.Annotate(
+			NewAccessLogWriter,
+			fx.ResultTags(`name:"access_log"`),
+		),
+		// Middleware applied around every route, ordered by priority
+		fx.Annotate(
+			NewChain,
+			fx.ParamTags(`group:"middleware"`),
+		),
+		AsMiddleware(NewTracingMiddleware),
+		AsMiddleware(NewRequestIDMiddleware),
+		AsMiddleware(NewSecurityHeadersMiddleware),
+		AsMiddleware(NewUserMiddleware),
+		AsMiddleware(NewResponseHeadersMiddleware),
+		AsMiddleware(NewAccessLogMiddleware),
+		AsMiddleware(NewRecentRequestsMiddleware),
+		AsMiddleware(NewHTTPSRedirectMiddleware),
+		AsMiddleware(NewDumpMiddleware),
+		AsMiddleware(NewMetricsMiddleware),
+		AsMiddleware(NewStatsMiddleware),
+		AsMiddleware(NewShutdownMiddleware),
+		AsMiddleware(NewHeaderLimitMiddleware),
+		AsMiddleware(NewRateLimitMiddleware),
+		AsMiddleware(NewGzipMiddleware),
+		AsMiddleware(NewIdempotencyMiddleware),
+		AsMiddleware(NewRecoveryMiddleware),
+		AsMiddleware(NewCORSMiddleware),
+		AsMiddleware(NewDeadlineMiddleware),
+		AsMiddleware(NewDecompressMiddleware),
+		// Every registered route, listed on /admin/routes
+		NewRouteTable,
+		// Build metadata injected at link time
+		NewBuildInfo,
+		// Register the built-in handlers as routes
+		AsRoute(NewHealthHandler),
+		AsHealthCheck(NewGoroutineChecker),
+		AsRoute(NewReadinessHandler),
+		AsRoute(NewVersionHandler),
+		AsRoute(NewSpecHandler),
+		AsAdminRoute(NewMetricsHandler),
+		AsAdminRoute(NewStatsHandler),
+		AsAdminRoute(NewRecentRequestsHandler),
+		AsAdminRoute(NewLogLevelHandler),
+		AsAdminRoute(NewShutdownHandler),
+		AsAdminRoute(NewDrainHandler),
+		AsAdminRoute(NewRoutesHandler),
+		AsAdminRoute(NewConfigHandler),
+		AsAdminRoute(NewPprofHandler),
+		// Register the Zap logger built from the log config, with a level
+		// that can be changed at runtime
+		NewLogLevel,
+		NewLogger,
+	),
+	// Serve the admin routes from a second server with its own mux
+	NamedServer("admin", adminRouteGroup),
+	// Invoke functions that need to run during application initialization
+	fx.Invoke(func(*http.Server) {}),
+	fx.Invoke(recordRoutes),
+	fx.Invoke(func(*ConfigReloader) {}),
+	fx.Invoke(fx.Annotate(
+		func(*http.Server) {},
+		fx.ParamTags(`name:"admin"`),
+	)),
+	// Drain traffic away before the servers shut down
+	LameDuckModule,
+)
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Route is an interface for HTTP handlers with a Pattern method
+type Route interface {
+	http.Handler
+	Pattern() string
+}
+
+// MethodRoute is an optional interface for routes restricted to specific HTTP methods
+type MethodRoute interface {
+	Route
+	Methods() []string
+}
+
+// PrioritizedRoute is an optional interface for routes that must be
+// registered before others, routes without it have priority 0. Higher
+// priorities register first, ties are broken by pattern so registration
+// order is deterministic despite value groups being unordered.
+//
+// http.ServeMux ignores registration order: since Go 1.22 the most
+// specific matching pattern wins, so "/files/{id}" beats "/files/" however
+// they were registered. Priority matters for routers that match in
+// registration order, and decides which route is reported first when two
+// patterns conflict.
+type PrioritizedRoute interface {
+	Route
+	Priority() int
+}
+
+// routePriority returns a route's registration priority
+func routePriority(route Route) int {
+	if pr, ok := route.(PrioritizedRoute); ok {
+		return pr.Priority()
+	}
+	return 0
+}
+
+// VersionedRoute is an optional interface for routes served under an API
+// version prefix, so several versions of an endpoint can coexist, e.g. a
+// route with pattern "/hello" and version "v2" is served at "/v2/hello".
+// Route patterns everywhere else, such as in the route table and concurrency
+// limits, include the prefix.
+type VersionedRoute interface {
+	Route
+	Version() string
+}
+
+// AliasedRoute is an optional interface for versioned routes also served at
+// their unversioned pattern, so clients of an endpoint from before it was
+// versioned keep working. Both patterns share the route's middleware, so
+// limits such as its concurrency apply across them.
+type AliasedRoute interface {
+	VersionedRoute
+	Unversioned() bool
+}
+
+// routePatterns returns every pattern a route is served at, its
+// routePattern followed by the unversioned alias of an AliasedRoute
+func routePatterns(route Route, cfg ServerConfig) []string {
+	patterns := []string{routePattern(route, cfg)}
+	ar, ok := route.(AliasedRoute)
+	if !ok || !ar.Unversioned() || ar.Version() == "" {
+		return patterns
+	}
+	pattern := route.Pattern()
+	if i := strings.Index(pattern, "/"); i >= 0 {
+		pattern = pattern[:i] + routeBasePath(route, cfg) + pattern[i:]
+	}
+	return append(patterns, pattern)
+}
+
+// routePattern returns the pattern a route is served at by the server
+// configured by cfg, with its version prefix and then the server's base path
+// inserted at the start of the path, after any host. Paths listed in
+// cfg.BasePathExempt keep their version prefix only.
+func routePattern(route Route, cfg ServerConfig) string {
+	host, path := versionedPattern(route)
+	return host + routeBasePath(route, cfg) + path
+}
+
+// versionedPattern splits a route's pattern into any host and the path with
+// the version prefix inserted. Patterns without a path are returned whole
+// as the host.
+func versionedPattern(route Route) (host, path string) {
+	pattern := route.Pattern()
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		return pattern, ""
+	}
+	host, path = pattern[:i], pattern[i:]
+	if vr, ok := route.(VersionedRoute); ok && vr.Version() != "" {
+		path = "/" + strings.Trim(vr.Version(), "/") + path
+	}
+	return host, path
+}
+
+// routeBasePath returns the base path a route is served under, empty when
+// there's none or the route is exempt
+func routeBasePath(route Route, cfg ServerConfig) string {
+	_, path := versionedPattern(route)
+	if path == "" || basePathExempt(path, cfg.BasePathExempt) {
+		return ""
+	}
+	return cfg.BasePath
+}
+
+// basePathExempt reports whether path is listed in exempt, either exactly
+// or under an entry ending in a slash
+func basePathExempt(path string, exempt []string) bool {
+	for _, p := range exempt {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteWithMiddleware is an optional interface for routes that need
+// middleware of their own on top of the global chain. Route middleware runs
+// inside the global chain, so global middleware like request IDs, access
+// logs and recovery still wrap it, and outside basic auth and content-type
+// enforcement. Within the slice the first middleware is outermost.
+type RouteWithMiddleware interface {
+	Route
+	Middlewares() []Middleware
+}
+
+// funcRoute adapts a plain handler func to the Route interface
+type funcRoute struct {
+	http.HandlerFunc
+	pattern string
+}
+
+// Pattern returns the URL pattern the func route was created with
+func (fr *funcRoute) Pattern() string {
+	return fr.pattern
+}
+
+// methodFuncRoute is a funcRoute restricted to specific HTTP methods
+type methodFuncRoute struct {
+	funcRoute
+	methods []string
+}
+
+// Methods returns the HTTP methods the func route was created with
+func (fr *methodFuncRoute) Methods() []string {
+	return fr.methods
+}
+
+// NewFuncRoute wraps a handler func into a Route for one-off endpoints, e.g.
+//
+//	AsRoute(func() Route { return NewFuncRoute("/ping", pingFn) })
+//
+// When methods are given the route only accepts those methods.
+func NewFuncRoute(pattern string, fn http.HandlerFunc, methods ...string) Route {
+	fr := funcRoute{HandlerFunc: fn, pattern: pattern}
+	if len(methods) == 0 {
+		return &fr
+	}
+	return &methodFuncRoute{funcRoute: fr, methods: methods}
+}
+
+// NewServeMux creates a Router from newRouter and registers routes wrapped in
+// the middleware chain, followed by any route-specific middleware and then
+// basic auth and content-type enforcement for routes that opt into them. It
+// fails rather than letting the mux panic when two routes claim the same
+// pattern. Oversized URIs are rejected and trailing slashes normalized ahead
+// of routing, according to the server config, which can also cap the
+// concurrency of individual routes and the time taken by and size of
+// responses from routes that aren't streaming.
+func NewServeMux(routes []Route, chain Chain, auth AuthConfig, newRouter RouterFactory, cfg ServerConfig, log *zap.Logger) (Router, error) {
+	basicAuth := BasicAuthMiddleware(auth)
+
+	// Collect every pattern to register, rejecting duplicates up front
+	var regs []registration
+	owners := make(map[string]Route)
+	methodsByPattern := make(map[string][]string)
+	add := func(key string, route Route, h http.Handler) error {
+		if prev, ok := owners[key]; ok {
+			return fmt.Errorf("duplicate route pattern %q registered by %T and %T", key, prev, route)
+		}
+		owners[key] = route
+		regs = append(regs, registration{key: key, handler: h})
+		return nil
+	}
+	// Register higher-priority routes first
+	routes = slices.Clone(routes)
+	slices.SortStableFunc(routes, func(a, b Route) int {
+		if c := cmp.Compare(routePriority(b), routePriority(a)); c != 0 {
+			return c
+		}
+		return strings.Compare(routePattern(a, cfg), routePattern(b, cfg))
+	})
+	for _, route := range routes {
+		routeChain := chain
+		if rm, ok := route.(RouteWithMiddleware); ok {
+			routeChain = append(slices.Clone(routeChain), rm.Middlewares()...)
+		}
+		if pr, ok := route.(ProtectedRoute); ok && pr.Protected() {
+			routeChain = append(slices.Clone(routeChain), basicAuth)
+		}
+		if ct, ok := route.(ContentTypeRoute); ok {
+			routeChain = append(slices.Clone(routeChain), EnforceContentTypeMiddleware(ct.ContentTypes()...))
+		}
+		if limit := routeConcurrency(route, cfg); limit > 0 {
+			routeChain = append(slices.Clone(routeChain), ConcurrencyLimitMiddleware(limit, cfg.ConcurrencyWait))
+		}
+		if cfg.RequestTimeout > 0 && !isStreaming(route) {
+			routeChain = append(slices.Clone(routeChain), TimeoutMiddleware(cfg.RequestTimeout))
+		}
+		if cfg.MaxResponseBytes > 0 && !isStreaming(route) {
+			routeChain = append(slices.Clone(routeChain), MaxResponseBytesMiddleware(cfg.MaxResponseBytes, log))
+		}
+		// Hide the base path from the route, so handlers matching on their
+		// own paths like file servers keep working, while the middleware
+		// still sees the full request path
+		var inner http.Handler = route
+		if base := routeBasePath(route, cfg); base != "" {
+			inner = http.StripPrefix(base, route)
+		}
+		chained := routeChain.Then(inner)
+
+		for _, pattern := range routePatterns(route, cfg) {
+			handler := withRoutePattern(pattern, chained)
+
+			// Routes without method constraints match every method
+			mr, ok := route.(MethodRoute)
+			if !ok {
+				if err := add(pattern, route, handler); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			// Register a method-qualified pattern per allowed method so the
+			// mux answers 405 for the rest
+			for _, method := range mr.Methods() {
+				if err := add(method+" "+pattern, route, handler); err != nil {
+					return nil, err
+				}
+				methodsByPattern[pattern] = append(methodsByPattern[pattern], method)
+			}
+		}
+	}
+
+	// Answer OPTIONS through the middleware so CORS preflights still work
+	for pattern, methods := range methodsByPattern {
+		if slices.Contains(methods, http.MethodOptions) {
+			continue
+		}
+		allow := joinAllow(append(methods, http.MethodOptions))
+		regs = append(regs, registration{
+			key:     http.MethodOptions + " " + pattern,
+			handler: withRoutePattern(pattern, chain.Then(optionsHandler(allow))),
+		})
+	}
+
+	// Register each route in a new router
+	router := newRouter()
+	for _, reg := range regs {
+		if err := handle(router, reg.key, reg.handler); err != nil {
+			return nil, err
+		}
+	}
+
+	// Catch unmatched paths with a JSON error unless a route owns the root.
+	// The mux prefers longer patterns, so real routes still take precedence,
+	// but "/" also matches paths only registered for other methods, so the
+	// catch-all asks a mux without it whether the answer should be a 405.
+	// Other routers render their own 404 and 405 responses.
+	preRouting := Chain{
+		URILengthMiddleware(cfg.MaxURIBytes),
+		TrailingSlashMiddleware(cfg.TrailingSlash, subtreePatterns(routes, cfg)),
+	}
+	routed, ok := router.(*http.ServeMux)
+	if _, owned := owners["/"]; !ok || owned {
+		return withPreRouting(router, preRouting), nil
+	}
+	mux := http.NewServeMux()
+	for _, reg := range regs {
+		mux.Handle(reg.key, reg.handler)
+	}
+	mux.Handle("/", withRoutePattern("/", chain.Then(notFoundHandler(routed))))
+
+	// Return the created ServeMux
+	return withPreRouting(mux, preRouting), nil
+}
+
+// preRoutedRouter serves requests through middleware that runs before
+// routing while registering routes on the wrapped router
+type preRoutedRouter struct {
+	Router
+	handler http.Handler
+}
+
+// withPreRouting wraps router in the chain, which sees every request before
+// the router picks a route
+func withPreRouting(router Router, chain Chain) Router {
+	return &preRoutedRouter{Router: router, handler: chain.Then(router)}
+}
+
+// ServeHTTP runs the pre-routing chain and then routes the request
+func (r *preRoutedRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// registration is a pattern and the handler to register for it
+type registration struct {
+	key     string
+	handler http.Handler
+}
+
+// handle registers a handler, turning the router's panic on conflicting or
+// invalid patterns into an error
+func handle(router Router, pattern string, h http.Handler) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("failed to register route pattern %q: %v", pattern, rec)
+		}
+	}()
+	router.Handle(pattern, h)
+	return nil
+}
+
+// notFoundHandler answers requests no route matched, letting the routed mux
+// decide between 404, 405 and path-cleaning redirects but rendering its
+// errors as JSON
+func notFoundHandler(routed *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, _ := routed.Handler(r)
+		h.ServeHTTP(&jsonErrorWriter{ResponseWriter: w}, r)
+	})
+}
+
+// jsonErrorWriter replaces the plaintext error bodies of the mux and of
+// http.FileServer with JSON errors. Both routers list the methods of a 405
+// in the Allow header, which is folded into a single sorted value so they
+// answer alike.
+type jsonErrorWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+// WriteHeader writes a JSON error instead of the mux's plaintext one
+func (w *jsonErrorWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusNotFound:
+		w.replaced = true
+		RespondError(w.ResponseWriter, status, ErrorCodeNotFound, "Not found")
+	case http.StatusMethodNotAllowed:
+		w.replaced = true
+		if allow := w.Header().Values("Allow"); len(allow) > 0 {
+			w.Header().Set("Allow", joinAllow(allow))
+		}
+		RespondError(w.ResponseWriter, status, ErrorCodeMethodNotAllowed, "Method not allowed")
+	case http.StatusForbidden:
+		w.replaced = true
+		RespondError(w.ResponseWriter, status, ErrorCodeForbidden, "Forbidden")
+	default:
+		if status < http.StatusBadRequest {
+			w.ResponseWriter.WriteHeader(status)
+			return
+		}
+		w.replaced = true
+		code := ErrorCodeBadRequest
+		if status >= http.StatusInternalServerError {
+			code = ErrorCodeInternal
+		}
+		RespondError(w.ResponseWriter, status, code, http.StatusText(status))
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *jsonErrorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Write discards the plaintext body once a JSON error has been written
+func (w *jsonErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// joinAllow merges Allow header values into one sorted, de-duplicated list
+func joinAllow(values []string) string {
+	var methods []string
+	for _, v := range values {
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				methods = append(methods, m)
+			}
+		}
+	}
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ", ")
+}
+
+// optionsHandler responds to OPTIONS requests with the allowed methods
+func optionsHandler(allow string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// adminRouteGroup is the value group holding routes served by the admin server
+const adminRouteGroup = "admin_routes"
+
+// AsRoute is a utility function to annotate a function as a Route, with
+// optional extra annotations such as fx.ParamTags
+func AsRoute(f any, anns ...fx.Annotation) any {
+	return asRouteInGroup(f, "routes", anns)
+}
+
+// AsAdminRoute annotates a function as a Route served by the admin server
+func AsAdminRoute(f any, anns ...fx.Annotation) any {
+	return asRouteInGroup(f, adminRouteGroup, anns)
+}
+
+// asRouteInGroup annotates a function as a Route in the given value group
+func asRouteInGroup(f any, group string, anns []fx.Annotation) any {
+	return fx.Annotate(f, append([]fx.Annotation{
+		fx.As(new(Route)),
+		fx.ResultTags(fmt.Sprintf(`group:"%s"`, group)),
+	}, anns...)...)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMethodNotAllowedListsAllowedMethods(t *testing.T) {
+	noop := func(http.ResponseWriter, *http.Request) {}
+	h := newTestMux(t, defaultServerConfig(),
+		NewFuncRoute("/submit", noop, http.MethodPost),
+		NewFuncRoute("/items", noop, http.MethodPost, http.MethodGet),
+	)
+
+	// GETting a POST-only route answers 405 with the methods it supports
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/submit", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "OPTIONS, POST" {
+		t.Errorf("GET /submit = %d Allow %q, want 405 Allow \"OPTIONS, POST\"", rec.Code, rec.Header().Get("Allow"))
+	}
+	if e := decodeError(t, rec); e.Code != ErrorCodeMethodNotAllowed {
+		t.Errorf("error code %q, want %q", e.Code, ErrorCodeMethodNotAllowed)
+	}
+
+	// OPTIONS reports the same sorted list as a 405 would
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/items", nil))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != "GET, OPTIONS, POST" {
+		t.Errorf("OPTIONS /items = %d Allow %q, want 204 Allow \"GET, OPTIONS, POST\"", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+// prioritizedRoute gives a func route a registration priority
+type prioritizedRoute struct {
+	Route
+	priority int
+}
+
+func (r prioritizedRoute) Priority() int { return r.priority }
+
+// recordingRouter is a ServeMux remembering the order patterns were
+// registered in
+type recordingRouter struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (r *recordingRouter) Handle(pattern string, h http.Handler) {
+	r.patterns = append(r.patterns, pattern)
+	r.ServeMux.Handle(pattern, h)
+}
+
+func TestRoutesRegisterByPriority(t *testing.T) {
+	named := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(name)) }
+	}
+	router := &recordingRouter{ServeMux: http.NewServeMux()}
+	h, err := NewServeMux([]Route{
+		NewFuncRoute("/", named("catch-all")),
+		NewFuncRoute("/b", named("b")),
+		prioritizedRoute{NewFuncRoute("/files/{id}", named("file")), 10},
+		NewFuncRoute("/a", named("a")),
+	}, nil, AuthConfig{}, func() Router { return router }, defaultServerConfig(), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The prioritized route comes first, the rest in pattern order
+	want := []string{"/files/{id}", "/", "/a", "/b"}
+	if !slices.Equal(router.patterns, want) {
+		t.Fatalf("registered %q, want %q", router.patterns, want)
+	}
+
+	// The mux still picks the most specific pattern however it was registered
+	for path, want := range map[string]string{"/files/1": "file", "/a": "a", "/other": "catch-all"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Body.String() != want {
+			t.Errorf("GET %s served by %q, want %q", path, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestRoutesServeUnderBasePath(t *testing.T) {
+	path := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.URL.Path)) }
+	cfg := defaultServerConfig()
+	cfg.BasePath = "/api"
+	h := newTestMux(t, cfg, NewFuncRoute("/hello", path), NewFuncRoute("/healthz", path))
+
+	// Routes move under the prefix, which their handlers don't see, while
+	// the exempt probe stays at its bare path
+	for path, want := range map[string]struct {
+		status int
+		body   string
+	}{
+		"/api/hello":   {http.StatusOK, "/hello"},
+		"/hello":       {http.StatusNotFound, ""},
+		"/healthz":     {http.StatusOK, "/healthz"},
+		"/api/healthz": {http.StatusNotFound, ""},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want.status || (want.body != "" && rec.Body.String() != want.body) {
+			t.Errorf("GET %s = %d %q, want %d %q", path, rec.Code, rec.Body, want.status, want.body)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// openAPIVersion is the version of the OpenAPI specification generated
+const openAPIVersion = "3.0.3"
+
+// RouteDescription documents a route in the OpenAPI spec
+type RouteDescription struct {
+	// Methods overrides the methods documented, defaulting to those of a
+	// MethodRoute and to GET otherwise
+	Methods []string
+	// Summary is a one-line description of the operation
+	Summary string
+	// RequestContentType is the media type of the request body, defaulting
+	// to application/json when RequestSchema is set
+	RequestContentType string
+	// RequestSchema is the JSON schema of the request body, nil when none
+	RequestSchema map[string]any
+	// ResponseContentType is the media type of the response, defaulting to
+	// application/json
+	ResponseContentType string
+	// ResponseSchema is the JSON schema of a successful response
+	ResponseSchema map[string]any
+}
+
+// DescribedRoute is a route that documents itself in the OpenAPI spec
+type DescribedRoute interface {
+	Route
+	Describe() RouteDescription
+}
+
+// SpecHandler is an HTTP handler serving an OpenAPI document for the public
+// routes, assembled on first use once every route has been recorded
+type SpecHandler struct {
+	table *RouteTable
+	info  BuildInfo
+	once  sync.Once
+	spec  map[string]any
+}
+
+// NewSpecHandler creates a new SpecHandler instance
+func NewSpecHandler(table *RouteTable, info BuildInfo) *SpecHandler {
+	return &SpecHandler{table: table, info: info}
+}
+
+// Pattern returns the URL pattern for the SpecHandler
+func (*SpecHandler) Pattern() string {
+	return "/openapi.json"
+}
+
+// Methods restricts the SpecHandler to GET (and therefore HEAD) requests
+func (*SpecHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// ServeHTTP responds with the OpenAPI document
+func (h *SpecHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.once.Do(func() {
+		h.spec = buildSpec(h.table.Routes(), h.info)
+	})
+	WriteJSON(w, http.StatusOK, h.spec)
+}
+
+// buildSpec assembles a minimal OpenAPI document from the public routes.
+// Routes that don't describe themselves are listed with their methods only.
+func buildSpec(routes []RouteInfo, info BuildInfo) map[string]any {
+	paths := make(map[string]any)
+	for _, ri := range routes {
+		if ri.Server != "public" {
+			continue
+		}
+
+		// Fill in the parts of the description the route leaves out
+		var desc RouteDescription
+		if dr, ok := ri.route.(DescribedRoute); ok {
+			desc = dr.Describe()
+		}
+		methods := desc.Methods
+		if len(methods) == 0 {
+			methods = ri.Methods
+		}
+		if len(methods) == 0 {
+			methods = []string{http.MethodGet}
+		}
+		if desc.RequestSchema != nil && desc.RequestContentType == "" {
+			desc.RequestContentType = "application/json"
+		}
+		if desc.ResponseContentType == "" {
+			desc.ResponseContentType = "application/json"
+		}
+
+		// Describe one operation per method on the route's path
+		path, params := specPath(ri.Pattern)
+		item := make(map[string]any)
+		for _, method := range methods {
+			op := map[string]any{
+				"responses": map[string]any{
+					"200": specResponse(desc),
+				},
+			}
+			if desc.Summary != "" {
+				op["summary"] = desc.Summary
+			}
+			if len(params) > 0 {
+				op["parameters"] = params
+			}
+			if desc.RequestSchema != nil {
+				op["requestBody"] = map[string]any{
+					"required": true,
+					"content": map[string]any{
+						desc.RequestContentType: map[string]any{"schema": desc.RequestSchema},
+					},
+				}
+			}
+			item[strings.ToLower(method)] = op
+		}
+		paths[path] = item
+	}
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "fxdemo",
+			"version": info.Version,
+		},
+		"paths": paths,
+	}
+}
+
+// specResponse describes the successful response of a route
+func specResponse(desc RouteDescription) map[string]any {
+	resp := map[string]any{"description": "OK"}
+	if desc.ResponseSchema != nil {
+		resp["content"] = map[string]any{
+			desc.ResponseContentType: map[string]any{"schema": desc.ResponseSchema},
+		}
+	}
+	return resp
+}
+
+// specPath converts a ServeMux pattern to an OpenAPI path, returning the
+// path parameters it declares
+func specPath(pattern string) (string, []map[string]any) {
+	var params []map[string]any
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.Trim(seg, "{}"), "...")
+		if name == "$" {
+			segments[i] = ""
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
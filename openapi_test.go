@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestSpecDescribesEchoAndHello(t *testing.T) {
+	app, info := newTestApp(t, nil)
+	app.RequireStart()
+	defer app.RequireStop()
+
+	resp, err := NewTestClient(info).Get(info.BaseURL() + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /openapi.json = %d, want 200", resp.StatusCode)
+	}
+	var spec struct {
+		OpenAPI string                               `json:"openapi"`
+		Paths   map[string]map[string]map[string]any `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.OpenAPI == "" {
+		t.Error("spec has no openapi version")
+	}
+
+	// The hello route describes itself, the echo is listed with its method
+	for path, method := range map[string]string{"/echo": "post", "/hello": "post"} {
+		op, ok := spec.Paths[path][method]
+		if !ok {
+			t.Errorf("spec has no %s %s, paths %v", method, path, spec.Paths)
+			continue
+		}
+		if _, ok := op["responses"]; !ok {
+			t.Errorf("%s %s has no responses", method, path)
+		}
+	}
+	if summary, _ := spec.Paths["/hello"]["post"]["summary"].(string); summary == "" {
+		t.Error("/hello has no summary")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"go.uber.org/zap"
+)
+
+// PprofHandler is an HTTP handler serving the net/http/pprof endpoints behind basic auth
+type PprofHandler struct {
+	mux *http.ServeMux
+}
+
+// NewPprofHandler creates a new PprofHandler, which only serves profiles when the feature flag is on
+func NewPprofHandler(log *zap.Logger, features FeatureFlags) *PprofHandler {
+	// Leave the mux empty so every request 404s unless profiling is enabled
+	mux := http.NewServeMux()
+	if features.EnablePprof {
+		log.Warn("pprof debug endpoints are enabled", zap.String("pattern", "/debug/pprof/"))
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return &PprofHandler{mux: mux}
+}
+
+// Pattern returns the URL prefix pattern for the PprofHandler
+func (*PprofHandler) Pattern() string {
+	return "/debug/pprof/"
+}
+
+// Protected requires basic auth for the profiling endpoints
+func (*PprofHandler) Protected() bool {
+	return true
+}
+
+// MaxConcurrency runs one profile at a time, since CPU profiles and traces
+// hold their request open and skew each other when run together
+func (*PprofHandler) MaxConcurrency() int {
+	return 1
+}
+
+// Streaming exempts profiles and traces, which grow with what they record,
+// from the request timeout and the response size limit
+func (*PprofHandler) Streaming() bool {
+	return true
+}
+
+// ServeHTTP delegates to the pprof mux
+func (h *PprofHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
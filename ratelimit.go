@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// defaultRateLimitIdleTTL is how long an unused per-IP bucket is kept
+const defaultRateLimitIdleTTL = 5 * time.Minute
+
+// RateLimitConfig holds the configuration for per-client rate limiting
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained rate allowed per client, zero disables limiting
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// Burst is the number of requests a client may make at once
+	Burst int `yaml:"burst"`
+	// IdleTTL is how long a client's bucket is kept after its last request
+	IdleTTL time.Duration `yaml:"idle_ttl"`
+}
+
+// loadEnv overrides the rate limits with any values set in the environment
+func (c *RateLimitConfig) loadEnv() error {
+	var err error
+	if c.RequestsPerSecond, err = envFloat("RATE_LIMIT_RPS", c.RequestsPerSecond); err != nil {
+		return err
+	}
+	if c.Burst, err = envInt("RATE_LIMIT_BURST", c.Burst); err != nil {
+		return err
+	}
+	if c.IdleTTL, err = envDuration("RATE_LIMIT_IDLE_TTL", c.IdleTTL); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a negative rate, TTL or burst, or an enabled limiter
+// that could never admit a request
+func (c *RateLimitConfig) Validate() error {
+	errs := []error{
+		checkNotNegative("rate_limit.requests_per_second", c.RequestsPerSecond),
+		checkNotNegative("rate_limit.burst", c.Burst),
+		checkNotNegative("rate_limit.idle_ttl", c.IdleTTL),
+	}
+	if c.RequestsPerSecond > 0 && c.Burst == 0 {
+		errs = append(errs, errors.New("rate_limit.burst must be at least 1 when rate limiting is enabled"))
+	}
+	return errors.Join(errs...)
+}
+
+// clientLimiter is a client's token bucket and when it was last used
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter keeps a token bucket per client IP
+type RateLimiter struct {
+	cfg     RateLimitConfig
+	proxies TrustedProxies
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+}
+
+// NewRateLimiter creates a RateLimiter and evicts idle buckets while the app runs
+func NewRateLimiter(lc fx.Lifecycle, cfg RateLimitConfig, proxies TrustedProxies, log *zap.Logger) *RateLimiter {
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	if cfg.IdleTTL <= 0 {
+		cfg.IdleTTL = defaultRateLimitIdleTTL
+	}
+	rl := &RateLimiter{cfg: cfg, proxies: proxies, clients: make(map[string]*clientLimiter)}
+
+	// Nothing to evict when limiting is disabled
+	if cfg.RequestsPerSecond <= 0 {
+		return rl
+	}
+
+	// Run the eviction loop between start and stop
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(done)
+				rl.evictLoop(ctx, log)
+			}()
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+	return rl
+}
+
+// evictLoop periodically drops buckets that have been idle for longer than the TTL
+func (rl *RateLimiter) evictLoop(ctx context.Context, log *zap.Logger) {
+	ticker := time.NewTicker(rl.cfg.IdleTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := rl.evict(now); n > 0 {
+				log.Debug("Evicted idle rate limit buckets", zap.Int("count", n))
+			}
+		}
+	}
+}
+
+// evict removes buckets idle since before now minus the TTL and returns how many were dropped
+func (rl *RateLimiter) evict(now time.Time) int {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	n := 0
+	for ip, c := range rl.clients {
+		if now.Sub(c.lastSeen) > rl.cfg.IdleTTL {
+			delete(rl.clients, ip)
+			n++
+		}
+	}
+	return n
+}
+
+// limiter returns the bucket for a client, creating it on first use
+func (rl *RateLimiter) limiter(ip string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	c, ok := rl.clients[ip]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(rl.cfg.RequestsPerSecond), rl.cfg.Burst)}
+		rl.clients[ip] = c
+	}
+	c.lastSeen = time.Now()
+	return c.limiter
+}
+
+// SetRate changes the sustained rate and burst, for new clients and for the
+// buckets of the ones already seen
+func (rl *RateLimiter) SetRate(rps float64, burst int) {
+	if burst <= 0 {
+		burst = 1
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.cfg.RequestsPerSecond, rl.cfg.Burst = rps, burst
+	for _, c := range rl.clients {
+		c.limiter.SetLimit(rate.Limit(rps))
+		c.limiter.SetBurst(burst)
+	}
+}
+
+// Middleware returns a Middleware answering 429 once a client exceeds its rate
+func (rl *RateLimiter) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		// Leave the route untouched when limiting is disabled
+		if rl.cfg.RequestsPerSecond <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Take a token, or tell the client how long until one is available
+			res := rl.limiter(clientAddr(r, rl.proxies)).Reserve()
+			if delay := res.Delay(); delay > 0 {
+				res.Cancel()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				RespondError(w, http.StatusTooManyRequests, ErrorCodeRateLimited, "Too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
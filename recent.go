@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// recentRequestsPattern is where the recent requests are served
+	recentRequestsPattern = "/admin/recent-requests"
+	// defaultRecentRequestsSize is how many requests are kept by default
+	defaultRecentRequestsSize = 100
+	// defaultRecentRequestsMaxBodyBytes caps each recorded body by default
+	defaultRecentRequestsMaxBodyBytes = 4 << 10
+)
+
+// RecentRequestsConfig controls the buffer of recent requests kept for live
+// debugging
+type RecentRequestsConfig struct {
+	// Size is how many requests are kept, zero disables recording
+	Size int `yaml:"size"`
+	// RecordBodies also keeps the start of each request and response body,
+	// off by default since bodies may hold personal data
+	RecordBodies bool `yaml:"record_bodies"`
+	// MaxBodyBytes caps each recorded body
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+}
+
+// loadEnv overrides the recent requests config with any values set in the
+// environment
+func (c *RecentRequestsConfig) loadEnv() error {
+	var err error
+	if c.Size, err = envInt("RECENT_REQUESTS_SIZE", c.Size); err != nil {
+		return err
+	}
+	if c.RecordBodies, err = envBool("RECENT_REQUESTS_RECORD_BODIES", c.RecordBodies); err != nil {
+		return err
+	}
+	if c.MaxBodyBytes, err = envInt64("RECENT_REQUESTS_MAX_BODY_BYTES", c.MaxBodyBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports a negative size or body cap
+func (c *RecentRequestsConfig) Validate() error {
+	return errors.Join(
+		checkNotNegative("recent_requests.size", c.Size),
+		checkNotNegative("recent_requests.max_body_bytes", c.MaxBodyBytes),
+	)
+}
+
+// RecentRequest describes a request that was served
+type RecentRequest struct {
+	Time         time.Time `json:"time"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Status       int       `json:"status"`
+	LatencyMS    float64   `json:"latency_ms"`
+	RequestID    string    `json:"request_id,omitempty"`
+	RequestBody  string    `json:"request_body,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+}
+
+// RecentRequests is a fixed-size ring buffer of the latest requests, the
+// oldest being overwritten once it is full
+type RecentRequests struct {
+	cfg     RecentRequestsConfig
+	mu      sync.Mutex
+	entries []RecentRequest
+	next    int
+	full    bool
+}
+
+// NewRecentRequests creates an empty RecentRequests buffer of the configured size
+func NewRecentRequests(cfg RecentRequestsConfig) *RecentRequests {
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = defaultRecentRequestsMaxBodyBytes
+	}
+	return &RecentRequests{cfg: cfg, entries: make([]RecentRequest, max(cfg.Size, 0))}
+}
+
+// Add records req, evicting the oldest request when the buffer is full
+func (rr *RecentRequests) Add(req RecentRequest) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if len(rr.entries) == 0 {
+		return
+	}
+	rr.entries[rr.next] = req
+	rr.next = (rr.next + 1) % len(rr.entries)
+	if rr.next == 0 {
+		rr.full = true
+	}
+}
+
+// Snapshot returns a copy of the recorded requests, newest first
+func (rr *RecentRequests) Snapshot() []RecentRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	n := rr.next
+	if rr.full {
+		n = len(rr.entries)
+	}
+	out := make([]RecentRequest, 0, n)
+	for i := range n {
+		out = append(out, rr.entries[(rr.next-1-i+len(rr.entries))%len(rr.entries)])
+	}
+	return out
+}
+
+// capBuffer keeps the first max bytes written to it and discards the rest
+type capBuffer struct {
+	bytes.Buffer
+	max int64
+}
+
+// Write keeps what still fits and reports the whole of p as written
+func (b *capBuffer) Write(p []byte) (int, error) {
+	if room := b.max - int64(b.Len()); room > 0 {
+		b.Buffer.Write(p[:min(int64(len(p)), room)])
+	}
+	return len(p), nil
+}
+
+// bodyRecorder copies the start of the response body into a capBuffer
+type bodyRecorder struct {
+	*responseWriter
+	body *capBuffer
+}
+
+// Write records the start of the body before passing it on
+func (br *bodyRecorder) Write(b []byte) (int, error) {
+	br.body.Write(b)
+	return br.responseWriter.Write(b)
+}
+
+// Middleware records each request in the buffer once it has been served,
+// skipping the recent requests route itself. Bodies are only recorded when
+// enabled, and read as the route consumes them.
+func (rr *RecentRequests) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		if rr.cfg.Size <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if RoutePatternFromContext(r.Context()) == recentRequestsPattern {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Copy the bodies as they stream past when recording them
+			rw := newResponseWriter(w)
+			var out http.ResponseWriter = rw
+			var reqBody, respBody *capBuffer
+			if rr.cfg.RecordBodies {
+				reqBody = &capBuffer{max: rr.cfg.MaxBodyBytes}
+				respBody = &capBuffer{max: rr.cfg.MaxBodyBytes}
+				r.Body = readCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+				out = &bodyRecorder{responseWriter: rw, body: respBody}
+			}
+			start := time.Now()
+			next.ServeHTTP(out, r)
+
+			entry := RecentRequest{
+				Time:      start,
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    rw.Status(),
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				RequestID: RequestIDFromContext(r.Context()),
+			}
+			if rr.cfg.RecordBodies {
+				entry.RequestBody, entry.ResponseBody = reqBody.String(), respBody.String()
+			}
+			rr.Add(entry)
+		})
+	}
+}
+
+// RecentRequestsHandler is an HTTP handler listing the recent requests
+type RecentRequestsHandler struct {
+	recent *RecentRequests
+}
+
+// NewRecentRequestsHandler creates a new RecentRequestsHandler instance
+func NewRecentRequestsHandler(recent *RecentRequests) *RecentRequestsHandler {
+	return &RecentRequestsHandler{recent: recent}
+}
+
+// Pattern returns the URL pattern for the RecentRequestsHandler
+func (*RecentRequestsHandler) Pattern() string {
+	return recentRequestsPattern
+}
+
+// Methods restricts the RecentRequestsHandler to GET requests
+func (*RecentRequestsHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// Protected requires basic auth, since request paths and bodies may be
+// sensitive
+func (*RecentRequestsHandler) Protected() bool {
+	return true
+}
+
+// ServeHTTP responds with the recent requests as JSON, newest first
+func (h *RecentRequestsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, h.recent.Snapshot())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// recentPaths returns the paths in the buffer, newest first
+func recentPaths(rr *RecentRequests) []string {
+	var paths []string
+	for _, req := range rr.Snapshot() {
+		paths = append(paths, req.Path)
+	}
+	return paths
+}
+
+func TestRecentRequestsEvictsTheOldest(t *testing.T) {
+	rr := NewRecentRequests(RecentRequestsConfig{Size: 3})
+	h := rr.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	// Fill the buffer past its capacity of three
+	for _, path := range []string{"/1", "/2", "/3", "/4", "/5"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if got, want := recentPaths(rr), []string{"/5", "/4", "/3"}; !slices.Equal(got, want) {
+		t.Fatalf("buffer holds %q, want %q", got, want)
+	}
+
+	// The recent requests route lists them without bodies, which are off
+	rec := httptest.NewRecorder()
+	NewRecentRequestsHandler(rr).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, recentRequestsPattern, nil))
+	var listed []map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 3 || listed[0]["path"] != "/5" || listed[0]["status"] != float64(http.StatusTeapot) {
+		t.Fatalf("listed %v, want the three newest with their status", listed)
+	}
+	for _, key := range []string{"request_body", "response_body"} {
+		if _, ok := listed[0][key]; ok {
+			t.Errorf("listed a %s with body recording off", key)
+		}
+	}
+}
+
+func TestRecentRequestsRecordsCappedBodies(t *testing.T) {
+	rr := NewRecentRequests(RecentRequestsConfig{Size: 1, RecordBodies: true, MaxBodyBytes: 4})
+	h := rr.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("hello world")))
+
+	// The client gets the whole body while the buffer keeps the start of it
+	if rec.Body.String() != "hello world" {
+		t.Fatalf("response %q, want the whole body", rec.Body)
+	}
+	got := rr.Snapshot()[0]
+	if got.RequestBody != "hell" || got.ResponseBody != "hell" {
+		t.Fatalf("recorded bodies %q and %q, want the first 4 bytes", got.RequestBody, got.ResponseBody)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultRedisDialTimeout bounds establishing a Redis connection
+	defaultRedisDialTimeout = 5 * time.Second
+	// defaultRedisIOTimeout bounds each Redis read and write
+	defaultRedisIOTimeout = 3 * time.Second
+)
+
+// RedisModule provides a *redis.Client connected with the RedisConfig and
+// checked on /healthz, e.g.
+//
+//	fx.New(appOptions(), RedisModule)
+var RedisModule = fx.Module("redis",
+	fx.Provide(
+		NewRedisClient,
+		AsHealthCheck(NewRedisChecker),
+	),
+)
+
+// RedisConfig holds the configuration for the Redis client
+type RedisConfig struct {
+	// Addr is the host:port of the Redis server
+	Addr string `yaml:"addr"`
+	// Username authenticates with Redis ACLs, empty uses the default user
+	Username string `yaml:"username"`
+	// Password authenticates the connection, empty disables authentication
+	Password string `yaml:"password" sensitive:"true"`
+	// DB selects the database after connecting
+	DB int `yaml:"db"`
+	// PoolSize caps the pooled connections
+	PoolSize int `yaml:"pool_size"`
+	// MinIdleConns is how many idle connections the pool keeps open
+	MinIdleConns int `yaml:"min_idle_conns"`
+	// DialTimeout bounds establishing a connection
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+	// ReadTimeout bounds reading each reply
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout bounds writing each command
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+}
+
+// loadEnv overrides the Redis config with any values set in the environment
+func (c *RedisConfig) loadEnv() error {
+	c.Addr = envString("REDIS_ADDR", c.Addr)
+	c.Username = envString("REDIS_USERNAME", c.Username)
+	c.Password = envString("REDIS_PASSWORD", c.Password)
+	var err error
+	for _, n := range []struct {
+		key   string
+		value *int
+	}{
+		{"REDIS_DB", &c.DB},
+		{"REDIS_POOL_SIZE", &c.PoolSize},
+		{"REDIS_MIN_IDLE_CONNS", &c.MinIdleConns},
+	} {
+		if *n.value, err = envInt(n.key, *n.value); err != nil {
+			return err
+		}
+	}
+	for _, d := range []struct {
+		key   string
+		value *time.Duration
+	}{
+		{"REDIS_DIAL_TIMEOUT", &c.DialTimeout},
+		{"REDIS_READ_TIMEOUT", &c.ReadTimeout},
+		{"REDIS_WRITE_TIMEOUT", &c.WriteTimeout},
+	} {
+		if *d.value, err = envDuration(d.key, *d.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate reports a malformed address and negative pool or timeout settings
+func (c *RedisConfig) Validate() error {
+	errs := []error{
+		checkNotNegative("redis.db", c.DB),
+		checkNotNegative("redis.pool_size", c.PoolSize),
+		checkNotNegative("redis.min_idle_conns", c.MinIdleConns),
+		checkNotNegative("redis.dial_timeout", c.DialTimeout),
+		checkNotNegative("redis.read_timeout", c.ReadTimeout),
+		checkNotNegative("redis.write_timeout", c.WriteTimeout),
+	}
+	if c.Addr != "" {
+		errs = append(errs, checkAddr("redis.addr", c.Addr))
+	}
+	return errors.Join(errs...)
+}
+
+// NewRedisClient creates the client with the configured pool and timeouts,
+// pinging the server on start so the app refuses to run without a reachable
+// Redis, and closes it on stop
+func NewRedisClient(cfg RedisConfig, lc fx.Lifecycle, log *zap.Logger) (*redis.Client, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("a Redis address is required")
+	}
+
+	// Creating the client doesn't connect, the pool dials on first use
+	client := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		PoolSize:     cfg.PoolSize,
+		MinIdleConns: cfg.MinIdleConns,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	})
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if err := client.Ping(ctx).Err(); err != nil {
+				// Release the pool, since OnStop won't run for a failed start
+				_ = client.Close()
+				return fmt.Errorf("failed to reach Redis at %s: %w", cfg.Addr, err)
+			}
+			log.Info("Connected to Redis", zap.String("addr", cfg.Addr), zap.Int("db", cfg.DB), zap.Int("pool_size", cfg.PoolSize))
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			return client.Close()
+		},
+	})
+	return client, nil
+}
+
+// RedisChecker reports whether Redis answers a ping
+type RedisChecker struct {
+	client *redis.Client
+}
+
+// NewRedisChecker creates a RedisChecker for client
+func NewRedisChecker(client *redis.Client) *RedisChecker {
+	return &RedisChecker{client: client}
+}
+
+// Name identifies the RedisChecker in the health response
+func (*RedisChecker) Name() string {
+	return "redis"
+}
+
+// Check pings Redis
+func (c *RedisChecker) Check(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestRedisClientPingsOnStartAndClosesOnStop(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	lc := fxtest.NewLifecycle(t)
+	client, err := NewRedisClient(RedisConfig{Addr: server.Addr(), Password: "secret", PoolSize: 2}, lc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing connects until the app starts, which pings the server
+	if n := server.CurrentConnectionCount(); n != 0 {
+		t.Fatalf("%d connections before start, want 0", n)
+	}
+	lc.RequireStart()
+	if n := server.TotalConnectionCount(); n == 0 {
+		t.Fatal("start didn't connect to Redis")
+	}
+	if err := client.Set(context.Background(), "k", "v", 0).Err(); err != nil {
+		t.Fatalf("set after start: %v", err)
+	}
+
+	// Stopping closes the client and its pooled connections
+	lc.RequireStop()
+	if err := client.Ping(context.Background()).Err(); !errors.Is(err, redis.ErrClosed) {
+		t.Fatalf("ping after stop: %v, want redis.ErrClosed", err)
+	}
+}
+
+func TestRedisClientFailsStartWhenUnreachable(t *testing.T) {
+	// Take a free port and leave nothing listening on it
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	lc := fxtest.NewLifecycle(t)
+	client, err := NewRedisClient(RedisConfig{Addr: addr, DialTimeout: time.Second}, lc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lc.Start(context.Background())
+	if err == nil {
+		lc.RequireStop()
+		t.Fatal("start succeeded without a Redis server")
+	}
+	if !strings.Contains(err.Error(), "failed to reach Redis at "+addr) {
+		t.Errorf("error %q doesn't name the unreachable address", err)
+	}
+
+	// The failed start has already released the client
+	if err := client.Ping(context.Background()).Err(); !errors.Is(err, redis.ErrClosed) {
+		t.Errorf("ping after the failed start: %v, want redis.ErrClosed", err)
+	}
+}
+
+func TestRedisClientRequiresAnAddress(t *testing.T) {
+	if _, err := NewRedisClient(RedisConfig{}, fxtest.NewLifecycle(t), zap.NewNop()); err == nil {
+		t.Fatal("created a client without an address")
+	}
+}
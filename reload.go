@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigReloader re-reads the configuration on SIGHUP and applies the
+// settings that can change while running, the log level and the rate limits.
+// Any other setting that changed is logged as requiring a restart.
+type ConfigReloader struct {
+	log         *zap.Logger
+	level       zap.AtomicLevel
+	rateLimiter *RateLimiter
+
+	// mu guards cfg, the configuration last loaded
+	mu  sync.Mutex
+	cfg AppConfig
+}
+
+// NewConfigReloader creates a ConfigReloader listening for SIGHUP between
+// start and stop
+func NewConfigReloader(lc fx.Lifecycle, cfg *AppConfig, level zap.AtomicLevel, rateLimiter *RateLimiter, log *zap.Logger) *ConfigReloader {
+	cr := &ConfigReloader{log: log, level: level, rateLimiter: rateLimiter, cfg: *cfg}
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			signal.Notify(signals, syscall.SIGHUP)
+			SafeGo(log, func() {
+				defer close(done)
+				for range signals {
+					cr.Reload()
+				}
+			})
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			// Stop delivering signals, then let a reload in progress finish
+			signal.Stop(signals)
+			close(signals)
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+	return cr
+}
+
+// Config returns the configuration in effect, the one loaded at startup with
+// the reloaded settings applied
+func (cr *ConfigReloader) Config() AppConfig {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.cfg
+}
+
+// Reload loads the configuration again from the flags, environment and
+// config file, and applies the reloadable settings. A configuration that
+// fails to load or validate is rejected as a whole, keeping the one in use.
+func (cr *ConfigReloader) Reload() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.log.Info("Reloading configuration")
+	next, err := NewAppConfig()
+	if err != nil {
+		cr.log.Error("Failed to reload configuration, keeping the current one", zap.Error(err))
+		return
+	}
+
+	// Apply the log level, which NewAppConfig has already validated
+	prev := cr.cfg
+	if next.Log.Level != prev.Log.Level {
+		if err := cr.level.UnmarshalText([]byte(next.Log.Level)); err != nil {
+			cr.log.Error("Failed to apply the reloaded log level", zap.Error(err))
+		} else {
+			cr.log.Info("Applied reloaded setting", zap.String("setting", "log.level"),
+				zap.String("from", prev.Log.Level), zap.String("to", next.Log.Level))
+		}
+	}
+
+	// Apply new rate limits while limiting stays on. Switching it on or off
+	// changes the middleware chain, while limits changed with it off have
+	// nothing to apply to.
+	rl, nextRL := prev.RateLimit, next.RateLimit
+	switch enabled, nextEnabled := rl.RequestsPerSecond > 0, nextRL.RequestsPerSecond > 0; {
+	case enabled && nextEnabled && (rl.RequestsPerSecond != nextRL.RequestsPerSecond || rl.Burst != nextRL.Burst):
+		cr.rateLimiter.SetRate(nextRL.RequestsPerSecond, nextRL.Burst)
+		cr.log.Info("Applied reloaded setting", zap.String("setting", "rate_limit"),
+			zap.Float64("requests_per_second", nextRL.RequestsPerSecond), zap.Int("burst", nextRL.Burst))
+		rl.RequestsPerSecond, rl.Burst = nextRL.RequestsPerSecond, nextRL.Burst
+	case !enabled && !nextEnabled:
+		rl.RequestsPerSecond, rl.Burst = nextRL.RequestsPerSecond, nextRL.Burst
+	}
+
+	// Report everything else that differs, keeping the values in use so it
+	// is reported again until the restart happens
+	applied := prev
+	applied.Log.Level = next.Log.Level
+	applied.RateLimit = rl
+	for _, setting := range changedSettings("", reflect.ValueOf(applied), reflect.ValueOf(*next)) {
+		cr.log.Warn("Changed setting requires restart", zap.String("setting", setting))
+	}
+	cr.cfg = applied
+}
+
+// ConfigHandler is an HTTP handler showing the configuration in effect with
+// its sensitive settings redacted
+type ConfigHandler struct {
+	reloader *ConfigReloader
+	log      *zap.Logger
+}
+
+// NewConfigHandler creates a new ConfigHandler instance
+func NewConfigHandler(reloader *ConfigReloader, log *zap.Logger) *ConfigHandler {
+	return &ConfigHandler{reloader: reloader, log: log}
+}
+
+// Pattern returns the URL pattern for the ConfigHandler
+func (*ConfigHandler) Pattern() string {
+	return "/admin/config"
+}
+
+// Methods restricts the ConfigHandler to GET (and therefore HEAD) requests
+func (*ConfigHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// Protected requires basic auth, since even redacted settings reveal the
+// deployment's layout
+func (*ConfigHandler) Protected() bool {
+	return true
+}
+
+// ServeHTTP responds with the redacted configuration as JSON. It goes
+// through YAML first so the keys match the config file's and durations read
+// like "5s".
+func (h *ConfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	doc, err := redactedConfigDoc(h.reloader.Config())
+	if err != nil {
+		h.log.Error("Failed to encode configuration", zap.Error(err))
+		RespondError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
+		return
+	}
+	WriteJSON(w, http.StatusOK, doc)
+}
+
+// redactedConfigDoc converts the redacted config to a generic document
+// keyed by the YAML field names
+func redactedConfigDoc(cfg AppConfig) (map[string]any, error) {
+	out, err := yaml.Marshal(cfg.Redact())
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(out, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// changedSettings returns the dotted YAML names of the fields that differ
+// between a and b, descending into nested structs
+func changedSettings(prefix string, a, b reflect.Value) []string {
+	var changed []string
+	for i := range a.NumField() {
+		f := a.Type().Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		name = prefix + name
+		av, bv := a.Field(i), b.Field(i)
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			changed = append(changed, changedSettings(name+".", av, bv)...)
+		case !reflect.DeepEqual(av.Interface(), bv.Interface()):
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
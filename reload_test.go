@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSIGHUPReloadsLogLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(file string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("log:\n  level: info\nserver:\n  addr: \"127.0.0.1:1111\"\n")
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("HTTP_ADDR", "")
+
+	// Reloading parses the process flags, which here are the test binary's
+	args := os.Args
+	os.Args = []string{"fxdemo"}
+	t.Cleanup(func() { os.Args = args })
+
+	cfg, err := NewAppConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	level, err := NewLogLevel(cfg.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zap.InfoLevel)
+	lc := fxtest.NewLifecycle(t)
+	cr := NewConfigReloader(lc, cfg, level, NewRateLimiter(lc, cfg.RateLimit, nil, zap.NewNop()), zap.New(core))
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	// Change a reloadable and a restart-only setting, then send SIGHUP
+	write("log:\n  level: debug\nserver:\n  addr: \"127.0.0.1:2222\"\n")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for logs.FilterMessage("Changed setting requires restart").Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("configuration not reloaded after SIGHUP")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The log level is applied, the address only reported
+	if level.Level() != zapcore.DebugLevel {
+		t.Errorf("log level %v after reload, want debug", level.Level())
+	}
+	applied := logs.FilterMessage("Applied reloaded setting").All()
+	if len(applied) != 1 || applied[0].ContextMap()["setting"] != "log.level" || applied[0].ContextMap()["to"] != "debug" {
+		t.Errorf("applied %v, want only log.level to debug", applied)
+	}
+	restart := logs.FilterMessage("Changed setting requires restart").All()
+	if len(restart) != 1 || restart[0].ContextMap()["setting"] != "server.addr" {
+		t.Errorf("restart required for %v, want only server.addr", restart)
+	}
+	if got := cr.Config(); got.Log.Level != "debug" || got.Server.Addr != "127.0.0.1:1111" {
+		t.Errorf("config in effect has level %q and addr %q, want debug and the old address", got.Log.Level, got.Server.Addr)
+	}
+}
+
+func TestConfigHandlerRedactsSensitiveSettings(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Auth.Username = "admin"
+	cfg.Auth.Password = "hunter2"
+	cfg.Server.TLSCertFile = "/etc/tls/cert.pem"
+	cfg.DB.DSN = "postgres://app:secret@db/app"
+	cfg.Redis.Addr = "127.0.0.1:6379"
+	reloader := &ConfigReloader{cfg: *cfg}
+	h := NewConfigHandler(reloader, zap.NewNop())
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var doc map[string]map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sensitive settings are masked, unset ones left empty, the rest shown
+	for _, tc := range []struct {
+		section, key string
+		want         any
+	}{
+		{"auth", "password", redactedValue},
+		{"server", "tls_cert_file", redactedValue},
+		{"db", "dsn", redactedValue},
+		{"server", "tls_key_file", ""},
+		{"redis", "password", ""},
+		{"auth", "username", "admin"},
+		{"redis", "addr", "127.0.0.1:6379"},
+		{"log", "level", "info"},
+	} {
+		if got := doc[tc.section][tc.key]; got != tc.want {
+			t.Errorf("%s.%s = %q, want %q", tc.section, tc.key, got, tc.want)
+		}
+	}
+
+	// Serving it leaves the config the reloader holds intact
+	if reloader.cfg.Auth.Password != "hunter2" || reloader.cfg.DB.DSN != "postgres://app:secret@db/app" {
+		t.Errorf("serving the config redacted the one in use, password %q and DSN %q", reloader.cfg.Auth.Password, reloader.cfg.DB.DSN)
+	}
+}
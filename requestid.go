@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader is the header carrying the request correlation ID
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key holding the request ID
+type requestIDKey struct{}
+
+// RequestIDMiddleware propagates or generates an X-Request-ID for each request
+func RequestIDMiddleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Reuse the caller's ID, generating a new one when absent
+			id := r.Header.Get(requestIDHeader)
+			if id == "" {
+				id = uuid.NewString()
+			}
+
+			// Echo the ID on the response and expose it to handlers
+			w.Header().Set(requestIDHeader, id)
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext returns the request ID stored in the context, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
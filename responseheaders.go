@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ResponseHeadersConfig holds custom headers stamped on every response
+type ResponseHeadersConfig struct {
+	// Headers maps header names to their default values
+	Headers map[string]string `yaml:"headers"`
+}
+
+// loadEnv replaces the headers with RESPONSE_HEADERS when set, a list of
+// "Name=value" entries separated by semicolons, since values such as
+// Cache-Control directives contain commas
+func (c *ResponseHeadersConfig) loadEnv() error {
+	value, ok := os.LookupEnv("RESPONSE_HEADERS")
+	if !ok || value == "" {
+		return nil
+	}
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(value, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid RESPONSE_HEADERS entry %q, expected Name=value", entry)
+		}
+		headers[name] = strings.TrimSpace(val)
+	}
+	c.Headers = headers
+	return nil
+}
+
+// ResponseHeadersMiddleware sets the configured headers before the route
+// runs, so the route can still override them. Headers already set by
+// earlier middleware are left as they are.
+func ResponseHeadersMiddleware(headers map[string]string) Middleware {
+	// Canonicalize the names once rather than on every request
+	canonical := make(map[string]string, len(headers))
+	for name, value := range headers {
+		canonical[http.CanonicalHeaderKey(name)] = value
+	}
+	return func(next http.Handler) http.Handler {
+		if len(canonical) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for name, value := range canonical {
+				if _, ok := h[name]; !ok {
+					h.Set(name, value)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
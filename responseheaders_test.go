@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseHeadersDefaultsAreOverridable(t *testing.T) {
+	mw := ResponseHeadersMiddleware(map[string]string{
+		"x-served-by":   "edge-1",
+		"Cache-Control": "no-store",
+	})
+
+	// A route setting nothing gets every configured header
+	rec := httptest.NewRecorder()
+	mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Header().Get("X-Served-By") != "edge-1" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("headers %v, want the configured defaults", rec.Header())
+	}
+
+	// A route setting its own value wins over the default
+	rec = httptest.NewRecorder()
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "max-age=60" {
+		t.Fatalf("Cache-Control = %q, want the route's own value", got)
+	}
+
+	// Headers set by earlier middleware are left alone
+	rec = httptest.NewRecorder()
+	rec.Header().Set("X-Served-By", "origin")
+	mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("X-Served-By"); got != "origin" {
+		t.Fatalf("X-Served-By = %q, want the earlier value kept", got)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// ErrResponseTooLarge is returned by writes past the response size limit
+var ErrResponseTooLarge = errors.New("response exceeds the size limit")
+
+// StreamingRoute is an optional interface for routes whose responses are
+// streams of unbounded length, such as echoes and event streams, exempting
+// them from the request timeout and the response size limit
+type StreamingRoute interface {
+	Route
+	Streaming() bool
+}
+
+// isStreaming reports whether a route opted out of the request timeout and
+// the response size limit
+func isStreaming(route Route) bool {
+	sr, ok := route.(StreamingRoute)
+	return ok && sr.Streaming()
+}
+
+// limitedResponseWriter drops everything written past its limit
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	remaining int64
+	exceeded  bool
+	onExceed  func()
+}
+
+// Write passes b through up to the limit, truncating the rest
+func (lw *limitedResponseWriter) Write(b []byte) (int, error) {
+	if int64(len(b)) <= lw.remaining {
+		n, err := lw.ResponseWriter.Write(b)
+		lw.remaining -= int64(n)
+		return n, err
+	}
+
+	// Send what still fits and report the first write that didn't
+	n, err := lw.ResponseWriter.Write(b[:lw.remaining])
+	lw.remaining -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	if !lw.exceeded {
+		lw.exceeded = true
+		lw.onExceed()
+	}
+	return n, ErrResponseTooLarge
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (lw *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// MaxResponseBytesMiddleware truncates responses at max bytes, guarding
+// against a handler bug producing an endless body. The status and headers
+// will already have been sent, so the client sees a short body, and the
+// handler gets ErrResponseTooLarge from the write that crossed the limit.
+func MaxResponseBytesMiddleware(max int64, log *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lw := &limitedResponseWriter{ResponseWriter: w, remaining: max}
+			lw.onExceed = func() {
+				log.Error("Response exceeded the size limit, truncating it",
+					zap.String("route", RoutePatternFromContext(r.Context())),
+					zap.String("request_id", RequestIDFromContext(r.Context())),
+					zap.Int64("limit", max),
+				)
+			}
+			next.ServeHTTP(lw, r)
+		})
+	}
+}
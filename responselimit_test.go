@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMaxResponseBytesTruncatesAndLogs(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+
+	// The handler keeps writing past the limit, as a runaway loop would
+	var errs []error
+	h := MaxResponseBytesMiddleware(15, zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range 3 {
+			_, err := w.Write([]byte("0123456789"))
+			errs = append(errs, err)
+		}
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := rec.Body.String(); got != "012345678901234" {
+		t.Errorf("body %q, want the first 15 bytes", got)
+	}
+	if errs[0] != nil || !errors.Is(errs[1], ErrResponseTooLarge) || !errors.Is(errs[2], ErrResponseTooLarge) {
+		t.Errorf("write errors %v, want ErrResponseTooLarge from the write crossing the limit on", errs)
+	}
+
+	// The overflow is logged once, however many writes follow it
+	entries := logs.FilterMessage("Response exceeded the size limit, truncating it").All()
+	if len(entries) != 1 || entries[0].ContextMap()["limit"] != int64(15) {
+		t.Fatalf("logged %v, want one error with the limit", entries)
+	}
+}
+
+// streamingFuncRoute marks a func route as streaming
+type streamingFuncRoute struct{ Route }
+
+func (streamingFuncRoute) Streaming() bool { return true }
+
+func TestMaxResponseBytesExemptsStreamingRoutes(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	write := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(long)) }
+	cfg := defaultServerConfig()
+	cfg.MaxResponseBytes = 10
+	h := newTestMux(t, cfg,
+		NewFuncRoute("/capped", write),
+		streamingFuncRoute{NewFuncRoute("/stream", write)},
+	)
+
+	for path, want := range map[string]int{"/capped": 10, "/stream": 100} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Body.Len() != want {
+			t.Errorf("GET %s wrote %d bytes, want %d", path, rec.Body.Len(), want)
+		}
+	}
+}
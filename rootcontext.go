@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/fx"
+)
+
+// contextValuesGroup is the value group of values added to the root context
+const contextValuesGroup = "context_values"
+
+// ContextValue is an immutable value stored in the root context, and so
+// visible from every request context
+type ContextValue struct {
+	Key   any
+	Value any
+}
+
+// AsContextValue annotates a function returning a ContextValue so its value
+// is added to the root context
+func AsContextValue(f any) any {
+	return fx.Annotate(f, fx.ResultTags(`group:"`+contextValuesGroup+`"`))
+}
+
+// buildInfoKey is the context key the BuildInfo is stored under
+type buildInfoKey struct{}
+
+// BuildInfoFromContext returns the BuildInfo stored in the root context
+func BuildInfoFromContext(ctx context.Context) BuildInfo {
+	info, _ := ctx.Value(buildInfoKey{}).(BuildInfo)
+	return info
+}
+
+// rootContextParams holds the dependencies of the RootContext
+type rootContextParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	Info      BuildInfo
+	Values    []ContextValue `group:"context_values"`
+}
+
+// RootContext is the parent of every request context. It carries the shared
+// values and is cancelled when the app stops.
+type RootContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRootContext creates the RootContext and cancels it on stop. It is
+// built before the servers, so its hook runs after they have drained and
+// only cancels requests that outlived the graceful shutdown.
+func NewRootContext(p rootContextParams) *RootContext {
+	ctx := context.WithValue(context.Background(), buildInfoKey{}, p.Info)
+	for _, v := range p.Values {
+		ctx = context.WithValue(ctx, v.Key, v.Value)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p.Lifecycle.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+	return &RootContext{ctx: ctx, cancel: cancel}
+}
+
+// Context returns the root context
+func (rc *RootContext) Context() context.Context {
+	return rc.ctx
+}
+
+// AppContextModule cancels the AppContext as the first step of stopping,
+// before the lame duck period or any server or worker is torn down.
+//
+// OnStop hooks run in reverse registration order and module invokes run in
+// the order the modules are given, so it must come after every other module,
+// e.g.
+//
+//	fx.New(HTTPModule, WorkerModule, AppContextModule)
+var AppContextModule = fx.Module("appcontext",
+	fx.Invoke(registerAppContextCancel),
+)
+
+// AppContext spans the lifetime of the application, for background tasks
+// that should wind down as soon as it starts stopping.
+//
+// Request contexts don't derive from it, since cancelling them before the
+// servers drain would abort the requests a graceful shutdown lets finish.
+// They derive from the RootContext instead, which is cancelled last.
+type AppContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewAppContext creates the AppContext, cancelled on stop by
+// AppContextModule
+func NewAppContext() *AppContext {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AppContext{ctx: ctx, cancel: cancel}
+}
+
+// Context returns the application context
+func (ac *AppContext) Context() context.Context {
+	return ac.ctx
+}
+
+// Cancel cancels the application context, which is safe to call repeatedly
+func (ac *AppContext) Cancel() {
+	ac.cancel()
+}
+
+// registerAppContextCancel appends the OnStop hook cancelling the AppContext
+func registerAppContextCancel(lc fx.Lifecycle, app *AppContext) {
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			app.Cancel()
+			return nil
+		},
+	})
+}
+
+// serveWhileDrainingKey is the context key marking requests on a server that
+// keeps serving through shutdown
+type serveWhileDrainingKey struct{}
+
+// withServeWhileDraining marks ctx as belonging to a server that keeps
+// serving through shutdown
+func withServeWhileDraining(ctx context.Context) context.Context {
+	return context.WithValue(ctx, serveWhileDrainingKey{}, true)
+}
+
+// servesWhileDraining reports whether ctx belongs to a server that keeps
+// serving through shutdown
+func servesWhileDraining(ctx context.Context) bool {
+	v, _ := ctx.Value(serveWhileDrainingKey{}).(bool)
+	return v
+}
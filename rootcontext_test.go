@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+)
+
+// serviceNameKey is the context key of the shared value set in the test
+type serviceNameKey struct{}
+
+func TestRequestContextDerivesFromRootContext(t *testing.T) {
+	lc := fxtest.NewLifecycle(t)
+	root := NewRootContext(rootContextParams{
+		Lifecycle: lc,
+		Info:      BuildInfo{Version: "1.2.3"},
+		Values:    []ContextValue{{Key: serviceNameKey{}, Value: "fxdemo"}},
+	})
+	lc.RequireStart()
+
+	// The handler reports the shared values, then waits for cancellation
+	type seen struct {
+		service string
+		version string
+	}
+	values := make(chan seen, 1)
+	cancelled := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		service, _ := ctx.Value(serviceNameKey{}).(string)
+		values <- seen{service, BuildInfoFromContext(ctx).Version}
+		<-ctx.Done()
+		close(cancelled)
+	}))
+	srv.Config.BaseContext = func(net.Listener) context.Context { return root.Context() }
+	srv.Start()
+	defer srv.Close()
+	go func() {
+		if resp, err := srv.Client().Get(srv.URL); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	got := <-values
+	if got.service != "fxdemo" || got.version != "1.2.3" {
+		t.Fatalf("request saw service %q and version %q, want fxdemo and 1.2.3", got.service, got.version)
+	}
+
+	// Stopping the app cancels the root and with it the request
+	lc.RequireStop()
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request context not cancelled with the root context")
+	}
+}
+
+func TestAppContextCancelledWhenAppStops(t *testing.T) {
+	var app *AppContext
+	fxApp, _ := newTestApp(t, nil, fx.Populate(&app))
+	fxApp.RequireStart()
+	if err := app.Context().Err(); err != nil {
+		t.Fatalf("app context done while running: %v", err)
+	}
+	fxApp.RequireStop()
+	if err := app.Context().Err(); err != context.Canceled {
+		t.Fatalf("app context error %v after stop, want context.Canceled", err)
+	}
+}
+
+func TestAppContextCancelledBeforeOtherTeardown(t *testing.T) {
+	// A hook registered earlier, like a server's, stops after the cancel
+	lc := fxtest.NewLifecycle(t)
+	app := NewAppContext()
+	var errAtTeardown error
+	lc.Append(fx.Hook{OnStop: func(context.Context) error {
+		errAtTeardown = app.Context().Err()
+		return nil
+	}})
+	registerAppContextCancel(lc, app)
+	lc.RequireStart().RequireStop()
+	if errAtTeardown != context.Canceled {
+		t.Fatalf("app context error %v during teardown, want context.Canceled", errAtTeardown)
+	}
+}
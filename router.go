@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Router is the minimal interface NewServeMux registers routes on, so the
+// standard ServeMux can be swapped for a third-party router. Patterns use
+// the http.ServeMux syntax, e.g. "GET /hello/{name}" or "/static/".
+type Router interface {
+	http.Handler
+	Handle(pattern string, h http.Handler)
+}
+
+// RouterFactory creates an empty Router for each server's routes. Replace
+// it to plug in another router, e.g.
+//
+//	fx.Replace(RouterFactory(NewChiRouter))
+type RouterFactory func() Router
+
+// NewRouterFactory picks the router implementation named by the config
+func NewRouterFactory(cfg ServerConfig) (RouterFactory, error) {
+	switch cfg.Router {
+	case "", "servemux":
+		return func() Router { return http.NewServeMux() }, nil
+	case "chi":
+		return NewChiRouter, nil
+	default:
+		return nil, fmt.Errorf("unknown router %q, expected \"servemux\" or \"chi\"", cfg.Router)
+	}
+}
+
+// chiRouter adapts a chi.Mux to ServeMux-style patterns and JSON errors
+type chiRouter struct {
+	mux *chi.Mux
+}
+
+// NewChiRouter creates a Router backed by chi. Path values are available
+// through r.PathValue as with the standard ServeMux.
+func NewChiRouter() Router {
+	return &chiRouter{mux: chi.NewRouter()}
+}
+
+// Handle registers h, translating ServeMux subtree patterns like "/static/"
+// into chi's "/static/*" and letting GET routes answer HEAD as well
+func (cr *chiRouter) Handle(pattern string, h http.Handler) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = "", pattern
+	}
+	if strings.HasSuffix(path, "/") {
+		path += "*"
+	}
+	switch method {
+	case "":
+		cr.mux.Handle(path, h)
+	case http.MethodGet:
+		cr.mux.Method(http.MethodHead, path, h)
+		fallthrough
+	default:
+		cr.mux.Method(method, path, h)
+	}
+}
+
+// ServeHTTP dispatches the request, rendering chi's 404 and 405 responses
+// as JSON errors. Unmatched requests bypass the middleware chain.
+func (cr *chiRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !cr.mux.Match(chi.NewRouteContext(), r.Method, r.URL.Path) {
+		w = &jsonErrorWriter{ResponseWriter: w}
+	}
+	cr.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"sync"
+
+	"go.uber.org/fx"
+)
+
+// RouteInfo describes a registered route for introspection
+type RouteInfo struct {
+	Server    string   `json:"server"`
+	Pattern   string   `json:"pattern"`
+	Methods   []string `json:"methods,omitempty"`
+	Protected bool     `json:"protected,omitempty"`
+
+	// route is the registered route, for handlers that inspect it further
+	route Route
+}
+
+// newRouteInfo describes a route served by the named server at pattern
+func newRouteInfo(server, pattern string, route Route) RouteInfo {
+	info := RouteInfo{Server: server, Pattern: pattern, route: route}
+	if mr, ok := route.(MethodRoute); ok {
+		info.Methods = mr.Methods()
+	}
+	if pr, ok := route.(ProtectedRoute); ok {
+		info.Protected = pr.Protected()
+	}
+	return info
+}
+
+// RouteTable holds the routes of every server. It is filled in once the
+// graph is built, since the routes handler is itself one of the routes.
+type RouteTable struct {
+	mu     sync.RWMutex
+	routes []RouteInfo
+}
+
+// NewRouteTable creates an empty RouteTable
+func NewRouteTable() *RouteTable {
+	return &RouteTable{}
+}
+
+// Routes returns the registered routes sorted by server and pattern
+func (t *RouteTable) Routes() []RouteInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.routes
+}
+
+// routeTableParams holds the route groups recorded in the RouteTable
+type routeTableParams struct {
+	fx.In
+
+	Table       *RouteTable
+	Config      ServerConfig
+	AdminConfig ServerConfig `name:"admin"`
+	Routes      []Route      `group:"routes"`
+	AdminRoutes []Route      `group:"admin_routes"`
+}
+
+// recordRoutes fills the RouteTable from the route groups
+func recordRoutes(p routeTableParams) {
+	routes := make([]RouteInfo, 0, len(p.Routes)+len(p.AdminRoutes))
+	for _, route := range p.Routes {
+		for _, pattern := range routePatterns(route, p.Config) {
+			routes = append(routes, newRouteInfo("public", pattern, route))
+		}
+	}
+	for _, route := range p.AdminRoutes {
+		for _, pattern := range routePatterns(route, p.AdminConfig) {
+			routes = append(routes, newRouteInfo("admin", pattern, route))
+		}
+	}
+	slices.SortFunc(routes, func(a, b RouteInfo) int {
+		if c := cmp.Compare(a.Server, b.Server); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Pattern, b.Pattern)
+	})
+	p.Table.mu.Lock()
+	defer p.Table.mu.Unlock()
+	p.Table.routes = routes
+}
+
+// RoutesHandler is an HTTP handler listing every registered route
+type RoutesHandler struct {
+	table *RouteTable
+}
+
+// NewRoutesHandler creates a new RoutesHandler instance
+func NewRoutesHandler(table *RouteTable) *RoutesHandler {
+	return &RoutesHandler{table: table}
+}
+
+// Pattern returns the URL pattern for the RoutesHandler
+func (*RoutesHandler) Pattern() string {
+	return "/admin/routes"
+}
+
+// Methods restricts the RoutesHandler to GET (and therefore HEAD) requests
+func (*RoutesHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// ServeHTTP responds with the registered routes as JSON
+func (h *RoutesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, h.table.Routes())
+}
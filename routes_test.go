@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutesHandlerListsSortedRoutes(t *testing.T) {
+	noop := func(http.ResponseWriter, *http.Request) {}
+	table := NewRouteTable()
+	recordRoutes(routeTableParams{
+		Table:       table,
+		Config:      defaultServerConfig(),
+		AdminConfig: NewAdminServerConfig(defaultServerConfig()),
+		Routes: []Route{
+			NewFuncRoute("/zeta", noop),
+			NewFuncRoute("/alpha", noop, http.MethodPost),
+		},
+		AdminRoutes: []Route{NewRoutesHandler(table)},
+	})
+
+	rec := httptest.NewRecorder()
+	NewRoutesHandler(table).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/routes", nil))
+	var got []RouteInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sorted by server, then pattern, with the methods of restricted routes
+	want := []RouteInfo{
+		{Server: "admin", Pattern: "/admin/routes", Methods: []string{http.MethodGet}},
+		{Server: "public", Pattern: "/alpha", Methods: []string{http.MethodPost}},
+		{Server: "public", Pattern: "/zeta"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d routes %+v, want %+v", len(got), got, want)
+	}
+	for i := range want {
+		if got[i].Server != want[i].Server || got[i].Pattern != want[i].Pattern || len(got[i].Methods) != len(want[i].Methods) {
+			t.Errorf("route %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
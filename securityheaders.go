@@ -0,0 +1,53 @@
+package main
+
+import "net/http"
+
+// SecurityHeadersConfig holds the values of the security headers set on
+// every response, an empty value leaves that header out
+type SecurityHeadersConfig struct {
+	// ContentTypeOptions is the X-Content-Type-Options value, e.g. "nosniff"
+	ContentTypeOptions string `yaml:"content_type_options"`
+	// FrameOptions is the X-Frame-Options value, e.g. "DENY"
+	FrameOptions string `yaml:"frame_options"`
+	// StrictTransportSecurity is the HSTS value, only sent when TLS is enabled
+	StrictTransportSecurity string `yaml:"strict_transport_security"`
+	// ContentSecurityPolicy is the Content-Security-Policy value
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+}
+
+// loadEnv overrides the header values with any set in the environment
+func (c *SecurityHeadersConfig) loadEnv() {
+	c.ContentTypeOptions = envString("SECURITY_CONTENT_TYPE_OPTIONS", c.ContentTypeOptions)
+	c.FrameOptions = envString("SECURITY_FRAME_OPTIONS", c.FrameOptions)
+	c.StrictTransportSecurity = envString("SECURITY_HSTS", c.StrictTransportSecurity)
+	c.ContentSecurityPolicy = envString("SECURITY_CSP", c.ContentSecurityPolicy)
+}
+
+// SecurityHeadersMiddleware sets the configured security headers before the
+// route runs, so the route can still override them. HSTS is only sent when
+// tlsEnabled, since browsers ignore it over plain HTTP.
+func SecurityHeadersMiddleware(cfg SecurityHeadersConfig, tlsEnabled bool) Middleware {
+	// Resolve the headers once rather than on every request
+	headers := make(map[string]string)
+	for name, value := range map[string]string{
+		"X-Content-Type-Options":  cfg.ContentTypeOptions,
+		"X-Frame-Options":         cfg.FrameOptions,
+		"Content-Security-Policy": cfg.ContentSecurityPolicy,
+	} {
+		if value != "" {
+			headers[name] = value
+		}
+	}
+	if tlsEnabled && cfg.StrictTransportSecurity != "" {
+		headers["Strict-Transport-Security"] = cfg.StrictTransportSecurity
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for name, value := range headers {
+				h.Set(name, value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeadersOnResponses(t *testing.T) {
+	cfg := defaultAppConfig().SecurityHeaders
+	serve := func(tlsEnabled bool) http.Header {
+		h := SecurityHeadersMiddleware(cfg, tlsEnabled)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Header()
+	}
+
+	headers := serve(true)
+	for name, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Content-Security-Policy":   "default-src 'self'",
+		"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+	} {
+		if got := headers.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	// HSTS is left out over plain HTTP
+	if got := serve(false).Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q without TLS, want none", got)
+	}
+}
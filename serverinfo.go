@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+// defaultTestClientTimeout bounds each request made by a NewTestClient client
+const defaultTestClientTimeout = 5 * time.Second
+
+// ServerInfo records where a server actually listens, which differs from its
+// configured address when binding ":0" lets the kernel pick the port
+type ServerInfo struct {
+	// Addr is the resolved address of the primary listener, set on start
+	Addr net.Addr
+	// TLS reports whether the server speaks HTTPS
+	TLS bool
+}
+
+// NewServerInfo describes the server listening on the given listeners. Its
+// Addr is filled in on start, once the listeners are bound.
+func NewServerInfo(lc fx.Lifecycle, cfg ServerConfig, listeners *Listeners) *ServerInfo {
+	info := &ServerInfo{TLS: cfg.TLSEnabled()}
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			info.Addr = listeners.List()[0].Addr()
+			return nil
+		},
+	})
+	return info
+}
+
+// BaseURL returns the scheme and host to prefix request paths with. A
+// wildcard listen address is replaced by loopback so the URL can be dialled,
+// and a Unix socket uses a placeholder host, see NewTestClient.
+func (i *ServerInfo) BaseURL() string {
+	scheme := "http"
+	if i.TLS {
+		scheme = "https"
+	}
+	host := "localhost"
+	if addr, ok := i.Addr.(*net.TCPAddr); ok {
+		ip := addr.IP
+		if ip == nil || ip.IsUnspecified() {
+			ip = net.IPv4(127, 0, 0, 1)
+		}
+		host = net.JoinHostPort(ip.String(), strconv.Itoa(addr.Port))
+	}
+	return scheme + "://" + host
+}
+
+// NewTestClient returns an HTTP client for the server described by info,
+// with a timeout so a hung server fails a test instead of stalling it.
+// Requests to a Unix socket server are dialled over the socket.
+func NewTestClient(info *ServerInfo) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if info.Addr.Network() == "unix" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", info.Addr.String())
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: defaultTestClientTimeout}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestServerInfoBaseURL(t *testing.T) {
+	for want, info := range map[string]*ServerInfo{
+		"http://127.0.0.1:8080": {Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}},
+		"http://127.0.0.1:9000": {Addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 9000}},
+		"https://[::1]:8443":    {Addr: &net.TCPAddr{IP: net.IPv6loopback, Port: 8443}, TLS: true},
+		"http://localhost":      {Addr: &net.UnixAddr{Name: "/tmp/fxdemo.sock", Net: "unix"}},
+	} {
+		if got := info.BaseURL(); got != want {
+			t.Errorf("BaseURL of %v = %q, want %q", info.Addr, got, want)
+		}
+	}
+}
+
+func TestNewTestClientHasTimeout(t *testing.T) {
+	client := NewTestClient(&ServerInfo{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}})
+	if client.Timeout != defaultTestClientTimeout {
+		t.Fatalf("timeout %v, want %v", client.Timeout, defaultTestClientTimeout)
+	}
+}
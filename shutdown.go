@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// ShutdownHandler is an HTTP handler that begins a graceful shutdown
+type ShutdownHandler struct {
+	log        *zap.Logger
+	shutdowner fx.Shutdowner
+}
+
+// NewShutdownHandler creates a new ShutdownHandler instance
+func NewShutdownHandler(log *zap.Logger, shutdowner fx.Shutdowner) *ShutdownHandler {
+	return &ShutdownHandler{log: log, shutdowner: shutdowner}
+}
+
+// Pattern returns the URL pattern for the ShutdownHandler
+func (*ShutdownHandler) Pattern() string {
+	return "/admin/shutdown"
+}
+
+// Methods restricts the ShutdownHandler to POST requests
+func (*ShutdownHandler) Methods() []string {
+	return []string{http.MethodPost}
+}
+
+// Protected requires basic auth before the app can be shut down
+func (*ShutdownHandler) Protected() bool {
+	return true
+}
+
+// ServeHTTP confirms the request with a 202 and then asks fx to stop. The
+// stop sequence drains in-flight requests, this one included, before the
+// listeners close.
+func (h *ShutdownHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Send the confirmation before anything starts shutting down
+	WriteJSON(w, http.StatusAccepted, map[string]string{"status": "shutting down"})
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		h.log.Warn("Failed to flush shutdown response", zap.Error(err))
+	}
+
+	// Shutdown only signals the app, the stop hooks run once Run picks it up
+	h.log.Warn("Shutdown requested over HTTP",
+		zap.String("request_id", RequestIDFromContext(r.Context())),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+	if err := h.shutdowner.Shutdown(); err != nil {
+		h.log.Error("Failed to trigger shutdown", zap.Error(err))
+	}
+}
+
+// drainResponse is the JSON body returned by the DrainHandler
+type drainResponse struct {
+	Draining         bool  `json:"draining"`
+	RemainingSeconds int   `json:"remaining_seconds"`
+	InFlight         int64 `json:"in_flight"`
+}
+
+// DrainHandler is an HTTP handler reporting the progress of a graceful
+// shutdown, so deploy tooling can wait for the drain to finish
+type DrainHandler struct {
+	readiness *ReadinessState
+	inFlight  *InFlight
+	timeout   time.Duration
+}
+
+// NewDrainHandler creates a new DrainHandler instance, estimating the drain
+// time from the public server's drain timeout
+func NewDrainHandler(readiness *ReadinessState, inFlight *InFlight, cfg ServerConfig) *DrainHandler {
+	return &DrainHandler{readiness: readiness, inFlight: inFlight, timeout: cfg.withDefaults().DrainTimeout}
+}
+
+// Pattern returns the URL pattern for the DrainHandler
+func (*DrainHandler) Pattern() string {
+	return "/admin/drain"
+}
+
+// Methods restricts the DrainHandler to GET requests
+func (*DrainHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// ServeHTTP reports whether shutdown has begun, the seconds left until the
+// drain deadline and the requests still in flight
+func (h *DrainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The count is the public server's, which this admin request isn't part of
+	resp := drainResponse{InFlight: h.inFlight.Count()}
+	if start, ok := h.readiness.ShutdownStarted(); ok {
+		resp.Draining = true
+		remaining := h.timeout - time.Since(start)
+		resp.RemainingSeconds = int(math.Ceil(max(remaining, 0).Seconds()))
+	}
+	WriteJSON(w, http.StatusOK, resp)
+}
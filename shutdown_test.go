@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getDrain fetches the drain status from h
+func getDrain(t *testing.T, h http.Handler) drainResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/drain", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var resp drainResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestDrainHandlerReportsShutdownProgress(t *testing.T) {
+	readiness, inFlight := NewReadinessState(), NewInFlight()
+	cfg := defaultServerConfig()
+	cfg.DrainTimeout = 10 * time.Second
+	h := NewDrainHandler(readiness, inFlight, cfg)
+
+	// Nothing is draining while the app runs normally
+	if got := getDrain(t, h); got != (drainResponse{}) {
+		t.Fatalf("before shutdown got %+v, want nothing draining", got)
+	}
+
+	// Hold a public request open across the start of shutdown
+	entered, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	public := inFlight.Middleware()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(entered)
+		<-release
+	}))
+	go func() {
+		defer close(done)
+		public.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-entered
+	readiness.SetShuttingDown()
+
+	// The drain reports the time left on the drain timeout and the request
+	if got := getDrain(t, h); got != (drainResponse{Draining: true, RemainingSeconds: 10, InFlight: 1}) {
+		t.Errorf("while draining got %+v, want 10s remaining and 1 in flight", got)
+	}
+	close(release)
+	<-done
+	if got := getDrain(t, h); !got.Draining || got.InFlight != 0 {
+		t.Errorf("after the request finished got %+v, want draining with none in flight", got)
+	}
+}
+
+func TestDrainHandlerStopsCountingAtTheDeadline(t *testing.T) {
+	readiness := NewReadinessState()
+	cfg := defaultServerConfig()
+	cfg.DrainTimeout = time.Millisecond
+	h := NewDrainHandler(readiness, NewInFlight(), cfg)
+
+	// Past the drain timeout the remaining time holds at zero
+	readiness.SetShuttingDown()
+	time.Sleep(10 * time.Millisecond)
+	if got := getDrain(t, h); !got.Draining || got.RemainingSeconds != 0 {
+		t.Fatalf("past the deadline got %+v, want draining with 0 seconds remaining", got)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// defaultEventBufferSize is how many events a slow subscriber may fall behind
+const defaultEventBufferSize = 16
+
+// Event is a single server-sent event
+type Event struct {
+	// ID lets a reconnecting client resume via Last-Event-ID, omitted when empty
+	ID string
+	// Type names the event for addEventListener, omitted when empty
+	Type string
+	// Data is the payload, sent as one data line per line of text
+	Data string
+}
+
+// EventSource produces the events streamed by the SSEHandler
+type EventSource interface {
+	// Subscribe returns a channel of events, closed when the source shuts
+	// down, and a function to stop receiving them
+	Subscribe() (<-chan Event, func())
+}
+
+// EventBroker is an EventSource fanning published events out to every
+// subscriber
+type EventBroker struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+	log    *zap.Logger
+}
+
+// NewEventBroker creates an EventBroker that closes its subscriptions on stop
+func NewEventBroker(lc fx.Lifecycle, log *zap.Logger) *EventBroker {
+	b := &EventBroker{subs: make(map[chan Event]struct{}), log: log}
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			b.Close()
+			return nil
+		},
+	})
+	return b
+}
+
+// NewEventSource exposes the EventBroker as the EventSource streamed by the
+// SSEHandler, which a test can replace with its own producer
+func NewEventSource(b *EventBroker) EventSource {
+	return b
+}
+
+// Subscribe registers a new subscriber
+func (b *EventBroker) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, defaultEventBufferSize)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends ev to every subscriber, dropping it for those whose buffer
+// is full rather than blocking the publisher
+func (b *EventBroker) Publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			b.log.Debug("Dropped event for slow subscriber", zap.String("type", ev.Type))
+		}
+	}
+}
+
+// Close ends every subscription and rejects new ones
+func (b *EventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// SSEHandler is an HTTP handler streaming events as Server-Sent Events
+type SSEHandler struct {
+	log       *zap.Logger
+	source    EventSource
+	readiness *ReadinessState
+}
+
+// NewSSEHandler creates a new SSEHandler instance
+func NewSSEHandler(log *zap.Logger, source EventSource, readiness *ReadinessState) *SSEHandler {
+	return &SSEHandler{log: log, source: source, readiness: readiness}
+}
+
+// Pattern returns the URL pattern for the SSEHandler
+func (*SSEHandler) Pattern() string {
+	return "/events"
+}
+
+// Streaming exempts the event stream, which runs until the client leaves,
+// from the request timeout and the response size limit
+func (*SSEHandler) Streaming() bool {
+	return true
+}
+
+// Methods restricts the SSEHandler to GET requests
+func (*SSEHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// ServeHTTP streams events until the client disconnects, the source closes
+// or the server begins shutting down
+func (h *SSEHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Subscribe before sending the headers so no event is missed
+	events, unsubscribe := h.source.Subscribe()
+	defer unsubscribe()
+
+	// Send the headers straight away, rejecting writers that can't flush
+	// since every event must reach the client as soon as it is written
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		if errors.Is(err, http.ErrNotSupported) {
+			h.log.Error("Streaming unsupported by response writer", zap.Error(err))
+			RespondError(w, http.StatusInternalServerError, ErrorCodeInternal, "Streaming unsupported")
+		}
+		return
+	}
+
+	// The stream outlives the server's write timeout, so lift it
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.log.Debug("Failed to clear write deadline", zap.Error(err))
+	}
+
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			h.log.Debug("SSE client disconnected", zap.Error(ctx.Err()))
+			return
+		case <-h.readiness.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := writeEvent(w, ev); err != nil {
+				h.log.Debug("Failed to write event", zap.Error(err))
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent encodes ev in the text/event-stream format
+func writeEvent(w http.ResponseWriter, ev Event) (int, error) {
+	var b strings.Builder
+	if ev.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", ev.ID)
+	}
+	if ev.Type != "" {
+		fmt.Fprintf(&b, "event: %s\n", ev.Type)
+	}
+	for _, line := range strings.Split(ev.Data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return w.Write([]byte(b.String()))
+}
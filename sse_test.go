@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// chanSource is an EventSource streaming the events sent on its channel
+type chanSource chan Event
+
+func (s chanSource) Subscribe() (<-chan Event, func()) {
+	return s, func() {}
+}
+
+func TestSSEStreamsEventsAsTheyArrive(t *testing.T) {
+	source := make(chanSource)
+	srv := httptest.NewServer(NewSSEHandler(zap.NewNop(), source, NewReadinessState()))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	// Each event is flushed on its own, before the stream ends
+	body := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := body.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading event: %v", err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	source <- Event{ID: "1", Type: "greeting", Data: "hello\nworld"}
+	if got, want := readEvent(), "id: 1\nevent: greeting\ndata: hello\ndata: world\n"; got != want {
+		t.Fatalf("event %q, want %q", got, want)
+	}
+	source <- Event{Data: "second"}
+	if got := readEvent(); got != "data: second\n" {
+		t.Fatalf("event %q, want the second event", got)
+	}
+
+	// Closing the source ends the stream
+	close(source)
+	if _, err := body.ReadString('\n'); err == nil {
+		t.Fatal("stream still open after the source closed")
+	}
+}
+
+// plainWriter is a ResponseWriter that can't flush
+type plainWriter struct {
+	rec *httptest.ResponseRecorder
+}
+
+func (w plainWriter) Header() http.Header         { return w.rec.Header() }
+func (w plainWriter) Write(b []byte) (int, error) { return w.rec.Write(b) }
+func (w plainWriter) WriteHeader(status int)      { w.rec.WriteHeader(status) }
+
+func TestSSERejectsWritersThatCantFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewSSEHandler(zap.NewNop(), make(chanSource), NewReadinessState()).
+		ServeHTTP(plainWriter{rec}, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// StaticConfig holds the configuration for serving static assets
+type StaticConfig struct {
+	// Dir is the directory static files are served from
+	Dir string `yaml:"dir"`
+	// Prefix is the URL prefix the files are served under, ending in a slash
+	Prefix string `yaml:"prefix"`
+}
+
+// loadEnv overrides the directory and prefix with any values set in the
+// environment, making sure the prefix is a subtree pattern
+func (c *StaticConfig) loadEnv() {
+	c.Dir = envString("STATIC_DIR", c.Dir)
+	c.Prefix = envString("STATIC_PREFIX", c.Prefix)
+	if !strings.HasSuffix(c.Prefix, "/") {
+		c.Prefix += "/"
+	}
+}
+
+// StaticHandler is an HTTP handler serving files from a directory
+type StaticHandler struct {
+	log     *zap.Logger
+	prefix  string
+	handler http.Handler
+}
+
+// NewStaticHandler creates a new StaticHandler instance
+func NewStaticHandler(log *zap.Logger, cfg StaticConfig) *StaticHandler {
+	return &StaticHandler{
+		log:     log,
+		prefix:  cfg.Prefix,
+		handler: http.StripPrefix(strings.TrimSuffix(cfg.Prefix, "/"), http.FileServer(http.Dir(cfg.Dir))),
+	}
+}
+
+// Pattern returns the URL prefix pattern for the StaticHandler
+func (h *StaticHandler) Pattern() string {
+	return h.prefix
+}
+
+// Methods restricts the StaticHandler to GET (and therefore HEAD) requests
+func (*StaticHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// ServeHTTP implements the HTTP handler for StaticHandler
+func (h *StaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Refuse any path trying to climb out of the served directory
+	if containsDotDot(r.URL.Path) {
+		h.log.Warn("Rejected static path traversal", zap.String("path", r.URL.Path))
+		RespondError(w, http.StatusNotFound, ErrorCodeNotFound, "Not found")
+		return
+	}
+
+	// Render the file server's plaintext errors, like missing files, as JSON
+	h.handler.ServeHTTP(&jsonErrorWriter{ResponseWriter: w}, r)
+}
+
+// containsDotDot reports whether any path segment is ".."
+func containsDotDot(p string) bool {
+	for _, seg := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if seg == ".." {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestStaticHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.css"), []byte("body{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	static := NewStaticHandler(zap.NewNop(), StaticConfig{Dir: dir, Prefix: "/static/"})
+	h := newTestMux(t, defaultServerConfig(), static)
+
+	// Files under the prefix are served
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/static/app.css", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "body{}" {
+		t.Fatalf("got %d %q, want 200 \"body{}\"", rec.Code, rec.Body.String())
+	}
+
+	// Missing files and traversal attempts, which the mux would redirect
+	// before they reach the handler, are JSON 404s
+	for _, path := range []string{"/static/missing.css", "/static/../main.go"} {
+		req := httptest.NewRequest(http.MethodGet, "/static/x", nil)
+		req.URL.Path = path
+		rec := httptest.NewRecorder()
+		static.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", path, rec.Code)
+			continue
+		}
+		if got := decodeError(t, rec); got.Code != ErrorCodeNotFound {
+			t.Errorf("%s: code = %q, want %q", path, got.Code, ErrorCodeNotFound)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/beorn7/perks/quantile"
+)
+
+const (
+	// statsPattern is the URL pattern the latency summaries are served on
+	statsPattern = "/stats"
+	// defaultStatsWindow is how long latency samples count towards the summaries
+	defaultStatsWindow = 5 * time.Minute
+)
+
+// statsQuantiles are the tracked quantiles and their allowed error
+var statsQuantiles = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// StatsConfig holds the configuration for the latency summaries
+type StatsConfig struct {
+	// Window is how long samples are kept, summaries cover the last one to two windows
+	Window time.Duration `yaml:"window"`
+}
+
+// loadEnv overrides the stats config with any values set in the environment
+func (c *StatsConfig) loadEnv() error {
+	var err error
+	c.Window, err = envDuration("STATS_WINDOW", c.Window)
+	return err
+}
+
+// Validate reports a negative window
+func (c *StatsConfig) Validate() error {
+	return checkNotNegative("stats.window", c.Window)
+}
+
+// latencyWindow holds the quantile streams of the current and previous window
+type latencyWindow struct {
+	current  *quantile.Stream
+	previous *quantile.Stream
+	started  time.Time
+}
+
+// LatencyStats keeps streaming latency quantiles per route pattern. Samples
+// age out after two windows, so the summaries reflect recent behaviour.
+type LatencyStats struct {
+	mu       sync.Mutex
+	window   time.Duration
+	patterns map[string]*latencyWindow
+}
+
+// NewLatencyStats creates an empty LatencyStats
+func NewLatencyStats(cfg StatsConfig) *LatencyStats {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultStatsWindow
+	}
+	return &LatencyStats{window: cfg.Window, patterns: make(map[string]*latencyWindow)}
+}
+
+// rotate starts a new window once the current one has run its course,
+// dropping both when a whole window passed without samples
+func (s *LatencyStats) rotate(lw *latencyWindow, now time.Time) {
+	switch elapsed := now.Sub(lw.started); {
+	case elapsed >= 2*s.window:
+		lw.previous = quantile.NewTargeted(statsQuantiles)
+		lw.current = quantile.NewTargeted(statsQuantiles)
+		lw.started = now
+	case elapsed >= s.window:
+		lw.previous = lw.current
+		lw.current = quantile.NewTargeted(statsQuantiles)
+		lw.started = lw.started.Add(s.window)
+	}
+}
+
+// Observe records a request duration against its route pattern
+func (s *LatencyStats) Observe(pattern string, d time.Duration) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lw, ok := s.patterns[pattern]
+	if !ok {
+		lw = &latencyWindow{
+			current:  quantile.NewTargeted(statsQuantiles),
+			previous: quantile.NewTargeted(statsQuantiles),
+			started:  now,
+		}
+		s.patterns[pattern] = lw
+	}
+	s.rotate(lw, now)
+	lw.current.Insert(d.Seconds())
+}
+
+// latencySummary is the JSON summary of one route pattern's latencies
+type latencySummary struct {
+	Pattern string  `json:"pattern"`
+	Count   int     `json:"count"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+}
+
+// statsResponse is the JSON body returned by the stats route
+type statsResponse struct {
+	Window string           `json:"window"`
+	Routes []latencySummary `json:"routes"`
+}
+
+// Summaries returns each pattern's recent latency quantiles, slowest p99 first
+func (s *LatencyStats) Summaries() []latencySummary {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summaries := make([]latencySummary, 0, len(s.patterns))
+	for pattern, lw := range s.patterns {
+		// Query the previous and current windows together
+		s.rotate(lw, now)
+		merged := quantile.NewTargeted(statsQuantiles)
+		merged.Merge(lw.previous.Samples())
+		merged.Merge(lw.current.Samples())
+		if merged.Count() == 0 {
+			continue
+		}
+		summaries = append(summaries, latencySummary{
+			Pattern: pattern,
+			Count:   merged.Count(),
+			P50:     merged.Query(0.5) * 1000,
+			P90:     merged.Query(0.9) * 1000,
+			P99:     merged.Query(0.99) * 1000,
+		})
+	}
+	slices.SortFunc(summaries, func(a, b latencySummary) int {
+		return cmp.Compare(b.P99, a.P99)
+	})
+	return summaries
+}
+
+// Middleware records how long each request took against its route pattern,
+// skipping the stats route itself
+func (s *LatencyStats) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Key by route pattern rather than raw path to bound cardinality
+			pattern := RoutePatternFromContext(r.Context())
+			if pattern == statsPattern {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			s.Observe(pattern, time.Since(start))
+		})
+	}
+}
+
+// StatsHandler is an HTTP handler that reports per-route latency quantiles
+type StatsHandler struct {
+	stats *LatencyStats
+}
+
+// NewStatsHandler creates a new StatsHandler instance
+func NewStatsHandler(stats *LatencyStats) *StatsHandler {
+	return &StatsHandler{stats: stats}
+}
+
+// Pattern returns the URL pattern for the StatsHandler
+func (*StatsHandler) Pattern() string {
+	return statsPattern
+}
+
+// Methods restricts the StatsHandler to GET (and therefore HEAD) requests
+func (*StatsHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// ServeHTTP responds with the latency summaries as JSON
+func (h *StatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, statsResponse{
+		Window: h.stats.window.String(),
+		Routes: h.stats.Summaries(),
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// SummaryModule logs a summary of the application once it has started, and
+// hands run what it needs to summarize the stop. Like AppContextModule it
+// must come after every other module, so its start hook runs once the
+// servers are listening.
+var SummaryModule = fx.Module("summary",
+	fx.Provide(NewLifecycleSummary),
+	fx.Invoke(registerLifecycleSummary),
+)
+
+// lifecycleSummaryParams holds the dependencies of the LifecycleSummary
+type lifecycleSummaryParams struct {
+	fx.In
+
+	Config     *AppConfig
+	Info       *ServerInfo
+	AdminInfo  *ServerInfo `name:"admin" optional:"true"`
+	RouteTable *RouteTable
+	InFlight   *InFlight
+	Build      BuildInfo
+	Log        *zap.Logger
+}
+
+// LifecycleSummary logs what the application is running with when it starts,
+// and how long it ran and how much it served when it stops
+type LifecycleSummary struct {
+	params  lifecycleSummaryParams
+	started time.Time
+}
+
+// NewLifecycleSummary creates a new LifecycleSummary instance
+func NewLifecycleSummary(p lifecycleSummaryParams) *LifecycleSummary {
+	return &LifecycleSummary{params: p}
+}
+
+// registerLifecycleSummary appends the hook logging the start summary
+func registerLifecycleSummary(lc fx.Lifecycle, s *LifecycleSummary) {
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			s.logStart()
+			return nil
+		},
+	})
+}
+
+// logStart logs the addresses, routes and main settings the app started with
+func (s *LifecycleSummary) logStart() {
+	s.started = time.Now()
+	p := s.params
+	server := p.Config.Server.withDefaults()
+
+	// Count the routes of each server in the route table
+	routes := make(map[string]int)
+	for _, info := range p.RouteTable.Routes() {
+		routes[info.Server]++
+	}
+	fields := []zap.Field{
+		zap.String("version", p.Build.Version),
+		zap.Stringer("addr", p.Info.Addr),
+		zap.Bool("tls", p.Info.TLS),
+		zap.Int("routes", routes["public"]),
+	}
+	if p.AdminInfo != nil {
+		fields = append(fields, zap.Stringer("admin_addr", p.AdminInfo.Addr), zap.Int("admin_routes", routes["admin"]))
+	}
+	fields = append(fields,
+		zap.String("router", server.Router),
+		zap.String("log_level", p.Config.Log.Level),
+		zap.Bool("h2c", server.EnableH2C),
+		zap.Duration("request_timeout", server.RequestTimeout),
+		zap.Duration("drain_timeout", server.DrainTimeout),
+		zap.Bool("rate_limited", p.Config.RateLimit.RequestsPerSecond > 0),
+		zap.Bool("pprof", p.Config.Features.EnablePprof),
+	)
+	p.Log.Info("Application started", fields...)
+}
+
+// LogStop logs how long the app ran, the requests it served and how long it
+// took to stop, or a warning if it failed to stop cleanly
+func (s *LifecycleSummary) LogStop(shutdown time.Duration, err error) {
+	fields := []zap.Field{
+		zap.Duration("shutdown_duration", shutdown),
+		zap.Int64("requests_served", s.params.InFlight.Total()),
+		zap.Int64("in_flight", s.params.InFlight.Count()),
+	}
+	if !s.started.IsZero() {
+		fields = append(fields, zap.Duration("uptime", time.Since(s.started)))
+	}
+	if err != nil {
+		s.params.Log.Warn("Application stopped with errors", append(fields, zap.Error(err))...)
+		return
+	}
+	s.params.Log.Info("Application stopped", fields...)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLifecycleSummaryLogsStartAndStop(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	inFlight := NewInFlight()
+	s := NewLifecycleSummary(lifecycleSummaryParams{
+		Config:    defaultAppConfig(),
+		Info:      &ServerInfo{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}, TLS: true},
+		AdminInfo: &ServerInfo{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9090}},
+		RouteTable: &RouteTable{routes: []RouteInfo{
+			{Server: "public", Pattern: "/hello"},
+			{Server: "public", Pattern: "/echo"},
+			{Server: "admin", Pattern: "/healthz"},
+		}},
+		InFlight: inFlight,
+		Build:    BuildInfo{Version: "1.2.3"},
+		Log:      zap.New(core),
+	})
+
+	// The start summary has the addresses, routes and settings
+	s.logStart()
+	started := logs.FilterMessage("Application started").All()
+	if len(started) != 1 {
+		t.Fatalf("logged %d start summaries, want 1", len(started))
+	}
+	fields := started[0].ContextMap()
+	for key, want := range map[string]any{
+		"version":      "1.2.3",
+		"addr":         "127.0.0.1:8080",
+		"tls":          true,
+		"routes":       int64(2),
+		"admin_addr":   "127.0.0.1:9090",
+		"admin_routes": int64(1),
+		"log_level":    "info",
+	} {
+		if fields[key] != want {
+			t.Errorf("start %s = %v, want %v", key, fields[key], want)
+		}
+	}
+	for _, key := range []string{"router", "h2c", "request_timeout", "drain_timeout", "rate_limited", "pprof"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("start summary has no %s", key)
+		}
+	}
+
+	// The stop summary counts the requests the in-flight middleware saw
+	h := inFlight.Middleware()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for range 3 {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	s.LogStop(0, nil)
+	stopped := logs.FilterMessage("Application stopped").All()
+	if len(stopped) != 1 {
+		t.Fatalf("logged %d stop summaries, want 1", len(stopped))
+	}
+	fields = stopped[0].ContextMap()
+	if fields["requests_served"] != int64(3) || fields["in_flight"] != int64(0) {
+		t.Errorf("stop summary served %v with %v in flight, want 3 and 0", fields["requests_served"], fields["in_flight"])
+	}
+	for _, key := range []string{"uptime", "shutdown_duration"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("stop summary has no %s", key)
+		}
+	}
+
+	// A failed stop is a warning carrying the error
+	s.LogStop(0, errors.New("hook failed"))
+	if failed := logs.FilterMessage("Application stopped with errors").All(); len(failed) != 1 || failed[0].ContextMap()["error"] != "hook failed" {
+		t.Errorf("failed stop logged %v, want a warning with the error", failed)
+	}
+}
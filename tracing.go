@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// TracingConfig holds the configuration for OpenTelemetry tracing
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector URL, e.g. "http://localhost:4318",
+	// with "/v1/traces" appended when it has no path. Spans are recorded but
+	// not exported when empty.
+	Endpoint string `yaml:"endpoint"`
+	// ServiceName identifies this application in traces
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the fraction of new traces sampled, between 0 and 1
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+// loadEnv overrides the tracing config with any values set in the environment
+func (c *TracingConfig) loadEnv() error {
+	c.Endpoint = envString("OTEL_EXPORTER_OTLP_ENDPOINT", c.Endpoint)
+	c.ServiceName = envString("OTEL_SERVICE_NAME", c.ServiceName)
+	var err error
+	c.SampleRatio, err = envFloat("TRACING_SAMPLE_RATIO", c.SampleRatio)
+	return err
+}
+
+// Validate reports a sample ratio outside [0, 1] or a malformed endpoint
+func (c *TracingConfig) Validate() error {
+	var errs []error
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio must be between 0 and 1, got %v", c.SampleRatio))
+	}
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("tracing.endpoint is not a valid URL: %q", c.Endpoint))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewTracerProvider creates the tracer provider, exporting spans over OTLP
+// when an endpoint is configured, and flushes it on stop
+func NewTracerProvider(lc fx.Lifecycle, cfg TracingConfig, info BuildInfo, log *zap.Logger) (*sdktrace.TracerProvider, error) {
+	// Describe this service on every span, honouring the parent's sampling decision
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", info.Version),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+
+	// Batch spans to the collector when one is configured
+	if cfg.Endpoint != "" {
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracing endpoint %q: %w", cfg.Endpoint, err)
+		}
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = "/v1/traces"
+		}
+		exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint.String()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+		log.Info("Exporting traces", zap.Stringer("endpoint", endpoint))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+
+	// Flush pending spans once the servers have stopped
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return tp.Shutdown(ctx)
+		},
+	})
+	return tp, nil
+}
+
+// TracingMiddleware starts a server span per request, continuing any W3C
+// trace context sent by the caller. Spans are named after the route pattern
+// rather than the raw URL to keep span names low-cardinality.
+func TracingMiddleware(tp trace.TracerProvider) Middleware {
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	return func(next http.Handler) http.Handler {
+		// Record the route on the span started by otelhttp
+		withRoute := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.route", RoutePatternFromContext(r.Context())))
+			next.ServeHTTP(w, r)
+		})
+		return otelhttp.NewHandler(withRoute, "",
+			otelhttp.WithTracerProvider(tp),
+			otelhttp.WithPropagators(propagator),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return RoutePatternFromContext(r.Context())
+			}),
+		)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	pathpkg "path"
+	"strings"
+)
+
+// TrailingSlashPolicy selects how paths with a trailing slash are treated
+type TrailingSlashPolicy string
+
+const (
+	// TrailingSlashKeep routes paths exactly as requested
+	TrailingSlashKeep TrailingSlashPolicy = ""
+	// TrailingSlashStrip removes the trailing slash before routing
+	TrailingSlashStrip TrailingSlashPolicy = "strip"
+	// TrailingSlashRedirect sends the client to the path without the slash
+	TrailingSlashRedirect TrailingSlashPolicy = "redirect"
+)
+
+// TrailingSlashMiddleware makes "/hello/" reach the "/hello" route, either
+// by rewriting the path or by redirecting to it. It must wrap the router
+// rather than sit in the route chain, since it changes what gets routed.
+// Paths under a subtree pattern such as "/static/" are left alone, so
+// directory paths keep working.
+func TrailingSlashMiddleware(policy TrailingSlashPolicy, subtrees []string) Middleware {
+	return func(next http.Handler) http.Handler {
+		if policy == TrailingSlashKeep {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.Path
+			if path == "/" || !strings.HasSuffix(path, "/") || underSubtree(path, subtrees) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// Cleaning also collapses repeated slashes, so "//evil.com/" can't
+			// turn into a protocol-relative redirect to another host
+			canonical := pathpkg.Clean(path)
+
+			// Redirect to the canonical path, with a 308 for methods other than
+			// GET and HEAD so the body is sent again
+			if policy == TrailingSlashRedirect {
+				u := *r.URL
+				u.Path, u.RawPath = canonical, ""
+				status := http.StatusMovedPermanently
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					status = http.StatusPermanentRedirect
+				}
+				http.Redirect(w, r, u.RequestURI(), status)
+				return
+			}
+
+			// Route a copy of the request under the canonical path
+			r2 := r.Clone(r.Context())
+			r2.URL.Path, r2.URL.RawPath = canonical, ""
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// underSubtree reports whether path falls within one of the subtree prefixes
+func underSubtree(path string, subtrees []string) bool {
+	for _, prefix := range subtrees {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// subtreePatterns returns the path of every route pattern matching a whole
+// subtree, i.e. ending in a slash, apart from the root
+func subtreePatterns(routes []Route, cfg ServerConfig) []string {
+	var subtrees []string
+	for _, route := range routes {
+		for _, pattern := range routePatterns(route, cfg) {
+			if i := strings.Index(pattern, "/"); i > 0 {
+				// Drop any host, which never appears in the request path
+				pattern = pattern[i:]
+			}
+			if pattern != "/" && strings.HasSuffix(pattern, "/") {
+				subtrees = append(subtrees, pattern)
+			}
+		}
+	}
+	return subtrees
+}
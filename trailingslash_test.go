@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pathEcho answers with the path it was routed
+var pathEcho = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	_, _ = w.Write([]byte(r.URL.Path))
+})
+
+func TestTrailingSlashStrip(t *testing.T) {
+	h := TrailingSlashMiddleware(TrailingSlashStrip, []string{"/static/"})(pathEcho)
+	for path, want := range map[string]string{
+		"/hello/":      "/hello",
+		"/hello":       "/hello",
+		"/":            "/",
+		"/static/css/": "/static/css/",
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Body.String() != want {
+			t.Errorf("%s routed as %q, want %q", path, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestTrailingSlashRedirect(t *testing.T) {
+	h := TrailingSlashMiddleware(TrailingSlashRedirect, []string{"/static/"})(pathEcho)
+	for _, tc := range []struct {
+		method, target string
+		status         int
+		location       string
+	}{
+		{http.MethodGet, "/hello/?x=1", http.StatusMovedPermanently, "/hello?x=1"},
+		{http.MethodPost, "/hello/", http.StatusPermanentRedirect, "/hello"},
+		// Leading slashes never produce a redirect to another host
+		{http.MethodGet, "//evil.com/", http.StatusMovedPermanently, "/evil.com"},
+		{http.MethodGet, "///evil.com//", http.StatusMovedPermanently, "/evil.com"},
+		{http.MethodGet, "/static/css/", http.StatusOK, ""},
+	} {
+		req := httptest.NewRequest(tc.method, "/", nil)
+		// Set the path directly, as parsing would read leading slashes as a host
+		req.URL.Path, req.URL.RawQuery, _ = strings.Cut(tc.target, "?")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status || rec.Header().Get("Location") != tc.location {
+			t.Errorf("%s %s: got %d Location %q, want %d %q", tc.method, tc.target,
+				rec.Code, rec.Header().Get("Location"), tc.status, tc.location)
+		}
+	}
+}
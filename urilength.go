@@ -0,0 +1,21 @@
+package main
+
+import "net/http"
+
+// URILengthMiddleware rejects requests whose request target, the path and
+// query string as sent, is longer than max bytes with a 414. Zero or
+// negative disables the check.
+func URILengthMiddleware(max int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if max <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.RequestURI) > max {
+				RespondError(w, http.StatusRequestURITooLong, ErrorCodeURITooLong, "Request URI too long")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
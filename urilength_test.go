@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLongURIsGet414BeforeRouting(t *testing.T) {
+	cfg := defaultServerConfig()
+	cfg.MaxURIBytes = 64
+	h := newTestMux(t, cfg, NewFuncRoute("/search", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for target, want := range map[string]int{
+		"/search?q=short":                         http.StatusNoContent,
+		"/search?q=" + strings.Repeat("a", 100):   http.StatusRequestURITooLong,
+		"/" + strings.Repeat("b", 100) + "/other": http.StatusRequestURITooLong,
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("GET of %d bytes = %d, want %d", len(target), rec.Code, want)
+		}
+		if want == http.StatusRequestURITooLong {
+			if e := decodeError(t, rec); e.Code != ErrorCodeURITooLong {
+				t.Errorf("error code %q, want %q", e.Code, ErrorCodeURITooLong)
+			}
+		}
+	}
+}
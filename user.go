@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// User is the authenticated user a request is made on behalf of
+type User struct {
+	// ID uniquely identifies the user
+	ID string `json:"id"`
+	// Name is the display name, falling back to the ID
+	Name string `json:"name"`
+}
+
+// UserExtractor resolves the user a request is made on behalf of. It returns
+// a nil user for anonymous requests and an error for credentials that are
+// present but invalid. Replace it to authenticate another way, e.g. from a
+// JWT:
+//
+//	fx.Decorate(func() UserExtractor { return jwtUser })
+type UserExtractor func(r *http.Request) (*User, error)
+
+// NewUserExtractor creates the default UserExtractor, trusting the
+// X-Forwarded-User and X-Forwarded-Preferred-Username headers set by an
+// authenticating proxy. The headers are ignored unless the peer is a trusted
+// proxy, so clients can't claim to be anyone by sending them themselves.
+func NewUserExtractor(proxies TrustedProxies) UserExtractor {
+	return func(r *http.Request) (*User, error) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		if ip := net.ParseIP(host); ip == nil || !trusts(proxies, ip) {
+			return nil, nil
+		}
+		id := r.Header.Get("X-Forwarded-User")
+		if id == "" {
+			return nil, nil
+		}
+		name := r.Header.Get("X-Forwarded-Preferred-Username")
+		if name == "" {
+			name = id
+		}
+		return &User{ID: id, Name: name}, nil
+	}
+}
+
+// userKey is the context key holding the request's User
+type userKey struct{}
+
+// WithUser returns a copy of ctx carrying user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the User stored in the context, and false for
+// anonymous requests
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userKey{}).(*User)
+	return user, ok && user != nil
+}
+
+// UserMiddleware resolves the user of each request with extract and stores
+// it in the request context. Anonymous requests pass through without one,
+// while invalid credentials are answered with a 401.
+func UserMiddleware(extract UserExtractor, log *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := extract(r)
+			if err != nil {
+				log.Debug("Rejected request credentials", zap.String("request_id", RequestIDFromContext(r.Context())), zap.Error(err))
+				RespondError(w, http.StatusUnauthorized, ErrorCodeUnauthorized, "Invalid credentials")
+				return
+			}
+			if user != nil {
+				r = r.WithContext(WithUser(r.Context(), user))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+func TestMeGreetsTheForwardedUser(t *testing.T) {
+	proxies, err := NewTrustedProxies(ProxyConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := UserMiddleware(NewUserExtractor(proxies), zap.NewNop())(NewMeRoute())
+	get := func(remote string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/me", nil)
+		r.RemoteAddr = remote
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// A user forwarded by a trusted proxy is greeted by name, or by ID
+	for want, header := range map[string]map[string]string{
+		`{"greeting":"Hello, Ada"}`: {"X-Forwarded-User": "u1", "X-Forwarded-Preferred-Username": "Ada"},
+		`{"greeting":"Hello, u1"}`:  {"X-Forwarded-User": "u1"},
+	} {
+		if rec := get("10.0.0.1:1234", header); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != want {
+			t.Errorf("forwarded %v = %d %q, want 200 %s", header, rec.Code, rec.Body, want)
+		}
+	}
+
+	// Without the header, or from an untrusted peer, the request is anonymous
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"missing user":   get("10.0.0.1:1234", nil),
+		"untrusted peer": get("192.0.2.1:1234", map[string]string{"X-Forwarded-User": "u1"}),
+	} {
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s = %d, want 401", name, rec.Code)
+		}
+	}
+}
+
+func TestUserMiddlewareRejectsInvalidCredentials(t *testing.T) {
+	extract := func(*http.Request) (*User, error) { return nil, errors.New("expired token") }
+	called := false
+	h := UserMiddleware(extract, zap.NewNop())(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/me", nil))
+	if rec.Code != http.StatusUnauthorized || called {
+		t.Fatalf("status %d with handler called %v, want 401 before the handler", rec.Code, called)
+	}
+	if e := decodeError(t, rec); e.Code != ErrorCodeUnauthorized {
+		t.Errorf("error code %q, want %q", e.Code, ErrorCodeUnauthorized)
+	}
+}
+
+func TestUserExtractorIsSwappable(t *testing.T) {
+	// Replace the header extractor, as a JWT one would be
+	app, info := newTestApp(t, nil, fx.Decorate(func() UserExtractor {
+		return func(r *http.Request) (*User, error) {
+			if r.Header.Get("Authorization") != "Bearer ada" {
+				return nil, nil
+			}
+			return &User{ID: "u1", Name: "Ada"}, nil
+		}
+	}))
+	app.RequireStart()
+	defer app.RequireStop()
+
+	req, err := http.NewRequest(http.MethodGet, info.BaseURL()+"/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer ada")
+	resp, err := NewTestClient(info).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != `{"greeting":"Hello, Ada"}` {
+		t.Fatalf("GET /me = %d %q, want 200 greeting Ada", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Validate checks every section of the AppConfig, reporting all problems at
+// once joined into a single error rather than stopping at the first
+func (c *AppConfig) Validate() error {
+	err := errors.Join(
+		c.Server.Validate(),
+		c.Log.Validate(),
+		c.Tracing.Validate(),
+		c.Stats.Validate(),
+		c.Proxy.Validate(),
+		c.HTTPSRedirect.Validate(),
+		checkForwardedProto(c.HTTPSRedirect, c.Proxy),
+		c.Worker.Validate(),
+		c.RateLimit.Validate(),
+		c.Echo.Validate(),
+		c.WebSocket.Validate(),
+		c.Idempotency.Validate(),
+		c.Cache.Validate(),
+		c.RecentRequests.Validate(),
+		c.Dump.Validate(),
+		c.DB.Validate(),
+		c.Redis.Validate(),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return nil
+}
+
+// checkRequired reports an empty required field
+func checkRequired(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", name)
+	}
+	return nil
+}
+
+// checkOneOf reports a value outside the allowed set
+func checkOneOf(name, value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %q, got %q", name, allowed, value)
+}
+
+// checkNotNegative reports a negative duration or size
+func checkNotNegative[T int | int64 | float64 | time.Duration](name string, value T) error {
+	if value < 0 {
+		return fmt.Errorf("%s must not be negative, got %v", name, value)
+	}
+	return nil
+}
+
+// checkAddr reports an empty or malformed host:port address
+func checkAddr(name, addr string) error {
+	if addr == "" {
+		return fmt.Errorf("%s is required", name)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("%s is not a valid address: %w", name, err)
+	}
+	return nil
+}
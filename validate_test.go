@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := defaultAppConfig().Validate(); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+}
+
+func TestValidateRejectsInvalidConfigs(t *testing.T) {
+	for name, tc := range map[string]struct {
+		modify func(*AppConfig)
+		want   string
+	}{
+		"malformed address": {func(c *AppConfig) { c.Server.Addr = "localhost" }, "server.addr is not a valid address"},
+		"negative timeout":  {func(c *AppConfig) { c.Server.DrainTimeout = -time.Second }, "server.drain_timeout must not be negative"},
+		"empty log level":   {func(c *AppConfig) { c.Log.Level = "" }, "log.level is required"},
+		"unknown network":   {func(c *AppConfig) { c.Server.Network = "udp" }, "server.network must be one of"},
+		"missing socket":    {func(c *AppConfig) { c.Server.Network = "unix" }, "server.socket_path is required"},
+		"negative ws limit": {func(c *AppConfig) { c.WebSocket.ReadTimeout = -time.Second }, "websocket.read_timeout must not be negative"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultAppConfig()
+			tc.modify(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = ""
+	cfg.Log.Level = "loud"
+	cfg.Echo.MaxBodyBytes = -1
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("invalid config passed validation")
+	}
+	for _, want := range []string{"server.addr is required", "log.level", "echo.max_body_bytes must not be negative"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't mention %q", err, want)
+		}
+	}
+}
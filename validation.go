@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// NewValidator creates the validator shared by every handler that checks
+// decoded request bodies. Fields are reported by their JSON names so errors
+// match what clients sent.
+func NewValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	return v
+}
+
+// fieldError describes why a single field of a request failed validation
+type fieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// validationErrorResponse is the error envelope written for requests that
+// fail validation, listing each failing field
+type validationErrorResponse struct {
+	Error struct {
+		errorDetail
+		Fields []fieldError `json:"fields"`
+	} `json:"error"`
+}
+
+// RespondValidationError writes a 422 listing the fields that failed
+// validation. Errors that aren't validation failures, such as validating
+// something other than a struct, are a bug in the handler and become a 500.
+func RespondValidationError(w http.ResponseWriter, err error) {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		RespondError(w, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error")
+		return
+	}
+	var resp validationErrorResponse
+	resp.Error.errorDetail = errorDetail{Code: ErrorCodeValidationFailed, Message: "Request failed validation"}
+	for _, fe := range errs {
+		// Drop the top-level struct name from the namespace, leaving the path
+		// to the field within the body
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		resp.Error.Fields = append(resp.Error.Fields, fieldError{Field: field, Rule: fe.Tag(), Param: fe.Param()})
+	}
+	WriteJSON(w, http.StatusUnprocessableEntity, resp)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestHelloValidatesRequestBody(t *testing.T) {
+	cfg := defaultServerConfig()
+	h := newTestMux(t, cfg, NewHelloHandler(zap.NewNop(), NewValidator(), cfg))
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A valid body is greeted
+	if rec := post(`{"name":"Ada"}`); rec.Code != http.StatusOK {
+		t.Errorf("valid body = %d %q, want 200", rec.Code, rec.Body)
+	}
+
+	for name, tc := range map[string]struct {
+		body string
+		want fieldError
+	}{
+		"missing name":   {`{}`, fieldError{Field: "name", Rule: "required"}},
+		"empty name":     {`{"name":""}`, fieldError{Field: "name", Rule: "required"}},
+		"over-long name": {`{"name":"` + strings.Repeat("a", 65) + `"}`, fieldError{Field: "name", Rule: "max", Param: "64"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Invalid bodies get a 422 naming the field and the broken rule
+			rec := post(tc.body)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status %d, want 422", rec.Code)
+			}
+			var resp validationErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error.Code != ErrorCodeValidationFailed {
+				t.Errorf("error code %q, want %q", resp.Error.Code, ErrorCodeValidationFailed)
+			}
+			if !slices.Equal(resp.Error.Fields, []fieldError{tc.want}) {
+				t.Errorf("fields %+v, want %+v", resp.Error.Fields, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Build metadata, set at build time with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+var (
+	version   string
+	commit    string
+	buildTime string
+)
+
+// BuildInfo describes the running build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// NewBuildInfo creates a BuildInfo from the linker-injected values
+func NewBuildInfo() BuildInfo {
+	// Fall back to placeholders for builds without ldflags
+	info := BuildInfo{Version: version, Commit: commit, BuildTime: buildTime}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
+
+// VersionHandler is an HTTP handler that reports build metadata
+type VersionHandler struct {
+	log   *zap.Logger
+	info  BuildInfo
+	cache *ResponseCache
+}
+
+// NewVersionHandler creates a new VersionHandler instance
+func NewVersionHandler(log *zap.Logger, info BuildInfo, cache *ResponseCache) *VersionHandler {
+	return &VersionHandler{log: log, info: info, cache: cache}
+}
+
+// Middlewares caches the build metadata, which never changes while running
+func (h *VersionHandler) Middlewares() []Middleware {
+	return []Middleware{h.cache.Middleware()}
+}
+
+// Pattern returns the URL pattern for the VersionHandler
+func (*VersionHandler) Pattern() string {
+	return "/version"
+}
+
+// ServeHTTP implements the HTTP handler for VersionHandler
+func (h *VersionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Respond with the build metadata as JSON
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.info); err != nil {
+		h.log.Warn("Failed to write version response", zap.Error(err))
+	}
+}
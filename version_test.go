@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestVersionReportsBuildInfo(t *testing.T) {
+	// Without ldflags the placeholders are reported
+	info := NewBuildInfo()
+	if info.Version != "dev" || info.Commit != "unknown" || info.BuildTime != "unknown" {
+		t.Fatalf("build info %+v, want dev and unknown placeholders", info)
+	}
+
+	h := newTestMux(t, defaultServerConfig(), NewVersionHandler(zap.NewNop(), BuildInfo{
+		Version:   "1.2.3",
+		Commit:    "abc123",
+		BuildTime: "2024-01-02T03:04:05Z",
+	}, NewResponseCache(CacheConfig{})))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /version = %d %q, want 200 JSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"version": "1.2.3", "commit": "abc123", "build_time": "2024-01-02T03:04:05Z"}
+	if len(got) != len(want) {
+		t.Fatalf("body %v, want exactly %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultWSReadTimeout is how long a connection may go without a message or pong
+	defaultWSReadTimeout = 60 * time.Second
+	// defaultWSWriteTimeout bounds how long writing a single frame may take
+	defaultWSWriteTimeout = 10 * time.Second
+)
+
+// WSConfig holds the configuration for WebSocket routes
+type WSConfig struct {
+	// ReadTimeout is how long to wait for a message or pong before dropping
+	// the connection, zero for the default
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout bounds how long writing a single frame may take, zero for
+	// the default
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// MaxMessageBytes caps the size of a single incoming message, zero for
+	// the default
+	MaxMessageBytes int64 `yaml:"max_message_bytes"`
+}
+
+// loadEnv overrides the WebSocket limits with any values set in the environment
+func (c *WSConfig) loadEnv() error {
+	var err error
+	if c.ReadTimeout, err = envDuration("WS_READ_TIMEOUT", c.ReadTimeout); err != nil {
+		return err
+	}
+	if c.WriteTimeout, err = envDuration("WS_WRITE_TIMEOUT", c.WriteTimeout); err != nil {
+		return err
+	}
+	if c.MaxMessageBytes, err = envInt64("WS_MAX_MESSAGE_BYTES", c.MaxMessageBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Validate reports negative timeouts or message limits
+func (c *WSConfig) Validate() error {
+	return errors.Join(
+		checkNotNegative("websocket.read_timeout", c.ReadTimeout),
+		checkNotNegative("websocket.write_timeout", c.WriteTimeout),
+		checkNotNegative("websocket.max_message_bytes", c.MaxMessageBytes),
+	)
+}
+
+// WSEchoHandler is a WebSocket handler that echoes every message back
+type WSEchoHandler struct {
+	log      *zap.Logger
+	cfg      WSConfig
+	upgrader websocket.Upgrader
+
+	mu    sync.Mutex
+	conns map[*websocket.Conn]struct{}
+}
+
+// NewWSEchoHandler creates a new WSEchoHandler that closes its connections
+// on stop. Unset limits fall back to the defaults, since a zero read timeout
+// would expire every connection at once.
+func NewWSEchoHandler(lc fx.Lifecycle, log *zap.Logger, cfg WSConfig) *WSEchoHandler {
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = defaultWSReadTimeout
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaultWSWriteTimeout
+	}
+	if cfg.MaxMessageBytes <= 0 {
+		cfg.MaxMessageBytes = defaultMaxRequestBodyBytes
+	}
+	h := &WSEchoHandler{log: log, cfg: cfg, conns: make(map[*websocket.Conn]struct{})}
+
+	// Hijacked connections aren't tracked by http.Server.Shutdown, so close them ourselves
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			h.closeAll()
+			return nil
+		},
+	})
+	return h
+}
+
+// Pattern returns the URL pattern for the WSEchoHandler
+func (*WSEchoHandler) Pattern() string {
+	return "/ws/echo"
+}
+
+// Streaming exempts the upgrade, after which messages bypass the response
+// writer, from the request timeout and the response size limit
+func (*WSEchoHandler) Streaming() bool {
+	return true
+}
+
+// Methods restricts the WSEchoHandler to GET, the only method that can upgrade
+func (*WSEchoHandler) Methods() []string {
+	return []string{http.MethodGet}
+}
+
+// ServeHTTP upgrades the connection and echoes messages until the client leaves
+func (h *WSEchoHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Upgrade the connection; the upgrader answers failed handshakes itself
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.log.Warn("Failed to upgrade WebSocket connection", zap.Error(err))
+		return
+	}
+	h.track(conn)
+	defer h.untrack(conn)
+
+	// Drop the connection when neither messages nor pongs arrive in time
+	conn.SetReadLimit(h.cfg.MaxMessageBytes)
+	_ = conn.SetReadDeadline(time.Now().Add(h.cfg.ReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.cfg.ReadTimeout))
+	})
+
+	// Ping the client regularly so idle but healthy connections stay open
+	done := make(chan struct{})
+	defer close(done)
+	SafeGo(h.log, func() { h.keepAlive(conn, done) })
+
+	// Echo text and binary frames back until the client disconnects
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.log.Debug("WebSocket connection closed", zap.Error(err))
+			}
+			return
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout))
+		if err := conn.WriteMessage(msgType, msg); err != nil {
+			h.log.Debug("Failed to echo WebSocket message", zap.Error(err))
+			return
+		}
+	}
+}
+
+// keepAlive sends pings at a fraction of the read timeout until done is closed
+func (h *WSEchoHandler) keepAlive(conn *websocket.Conn, done <-chan struct{}) {
+	ticker := time.NewTicker(h.cfg.ReadTimeout * 9 / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.cfg.WriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// track records an open connection so it can be closed on shutdown
+func (h *WSEchoHandler) track(conn *websocket.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[conn] = struct{}{}
+}
+
+// untrack forgets a connection and closes it
+func (h *WSEchoHandler) untrack(conn *websocket.Conn) {
+	h.mu.Lock()
+	delete(h.conns, conn)
+	h.mu.Unlock()
+	_ = conn.Close()
+}
+
+// closeAll tells every open connection the server is going away and closes it
+func (h *WSEchoHandler) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for conn := range h.conns {
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(h.cfg.WriteTimeout))
+		_ = conn.Close()
+	}
+}
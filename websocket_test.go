@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestWSEchoDefaultsUnsetTimeouts(t *testing.T) {
+	// A config without timeouts must neither panic nor drop the connection
+	lc := fxtest.NewLifecycle(t)
+	srv := httptest.NewServer(NewWSEchoHandler(lc, zap.NewNop(), WSConfig{}))
+	defer srv.Close()
+	lc.RequireStart()
+	defer lc.RequireStop()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	msgType, msg, err := conn.ReadMessage()
+	if err != nil || msgType != websocket.TextMessage || string(msg) != "ping" {
+		t.Fatalf("read %d %q, %v, want the text message echoed", msgType, msg, err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// defaultWorkerInterval is how often the background worker ticks
+const defaultWorkerInterval = time.Minute
+
+// WorkerModule runs a background Worker between application start and stop,
+// handing its task a context derived from the AppContext.
+// Supply a WorkerTask to give it something to do on each tick, e.g.
+//
+//	fx.New(HTTPModule, WorkerModule, fx.Supply(WorkerTask(refreshCache)))
+var WorkerModule = fx.Module("worker",
+	fx.Provide(NewWorker),
+	fx.Invoke(func(*Worker) {}),
+)
+
+// WorkerConfig holds the configuration for the background worker
+type WorkerConfig struct {
+	// Interval is the time between ticks, zero or negative disables the worker
+	Interval time.Duration `yaml:"interval"`
+}
+
+// loadEnv overrides the worker config with any values set in the environment
+func (c *WorkerConfig) loadEnv() error {
+	var err error
+	c.Interval, err = envDuration("WORKER_INTERVAL", c.Interval)
+	return err
+}
+
+// Validate reports a negative interval
+func (c *WorkerConfig) Validate() error {
+	return checkNotNegative("worker.interval", c.Interval)
+}
+
+// WorkerTask is the work run on every tick, its context is cancelled on stop
+type WorkerTask func(context.Context) error
+
+// workerParams holds the dependencies of the Worker
+type workerParams struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	App       *AppContext
+	Config    WorkerConfig
+	Task      WorkerTask `optional:"true"`
+	Log       *zap.Logger
+}
+
+// Worker runs a task on a fixed interval in a background goroutine
+type Worker struct {
+	log      *zap.Logger
+	app      *AppContext
+	interval time.Duration
+	task     WorkerTask
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewWorker creates a Worker and ties its loop to the application lifecycle
+func NewWorker(p workerParams) *Worker {
+	w := &Worker{log: p.Log, app: p.App, interval: p.Config.Interval, task: p.Task}
+	if w.interval <= 0 {
+		p.Log.Info("Background worker disabled")
+		return w
+	}
+	p.Lifecycle.Append(fx.Hook{
+		OnStart: w.Start,
+		OnStop:  w.Stop,
+	})
+	return w
+}
+
+// Start launches the ticker loop, which outlives the start context and
+// ends with the application context
+func (w *Worker) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(w.app.Context())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go w.run(ctx)
+	w.log.Info("Started background worker", zap.Duration("interval", w.interval))
+	return nil
+}
+
+// Stop cancels the loop and waits for it to exit within the stop deadline
+func (w *Worker) Stop(ctx context.Context) error {
+	w.cancel()
+	select {
+	case <-w.done:
+		w.log.Info("Stopped background worker")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run calls the task on every tick until ctx is cancelled
+func (w *Worker) run(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for tick := 1; ; tick++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.log.Debug("Worker tick", zap.Int("tick", tick))
+		if w.task == nil {
+			continue
+		}
+		if err := w.task(ctx); err != nil && ctx.Err() == nil {
+			w.log.Warn("Worker task failed", zap.Int("tick", tick), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/fx"
+)
+
+func TestWorkerTicksAndStopsPromptly(t *testing.T) {
+	cfg := defaultAppConfig()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Worker.Interval = 10 * time.Millisecond
+
+	// The task blocks on its context the way a slow refresh would
+	ticked := make(chan struct{}, 1)
+	task := WorkerTask(func(ctx context.Context) error {
+		select {
+		case ticked <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	app, _ := newTestApp(t, cfg, fx.Supply(task))
+	app.RequireStart()
+	select {
+	case <-ticked:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker never ticked")
+	}
+
+	// Stopping cancels the running task and waits for the loop to exit
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := app.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("stop took %s, want it prompt", elapsed)
+	}
+}